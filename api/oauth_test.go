@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverOIDCProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/.well-known/openid-configuration":
+			w.Write([]byte(`{"authorization_endpoint": "https://idp/auth", "token_endpoint": "https://idp/token", "userinfo_endpoint": "https://idp/userinfo"}`))
+		case "/partial/.well-known/openid-configuration":
+			w.Write([]byte(`{"authorization_endpoint": "https://idp/auth"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := DiscoverOIDCProvider(context.Background(), "idp", server.URL+"/good/", "id", "secret", "https://app/callback")
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp/token", provider.endpoints.TokenURL)
+	assert.Equal(t, "https://idp/userinfo", provider.endpoints.UserInfoURL)
+	assert.Contains(t, provider.AuthCodeURL("state", "challenge"), "https://idp/auth?")
+	// discovery and the login share the client with the timeout
+	assert.NotZero(t, provider.httpClient.Timeout)
+
+	_, err = DiscoverOIDCProvider(context.Background(), "idp", server.URL+"/partial", "id", "secret", "https://app/callback")
+	assert.Error(t, err)
+	_, err = DiscoverOIDCProvider(context.Background(), "idp", server.URL+"/missing", "id", "secret", "https://app/callback")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// PaymentEvent is a subscription change reported by a payment provider. Type is
+// models.PaymentEventSubscriptionActive for new and renewed subscriptions and
+// models.PaymentEventSubscriptionCanceled when the access must end.
+type PaymentEvent struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	UserID         uint      `json:"user_id"`
+	Plan           string    `json:"plan"`
+	SubscriptionID string    `json:"subscription_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// PaymentProvider hides the differences between payment providers, every provider
+// signs its webhooks in its own way.
+type PaymentProvider interface {
+	Name() string
+	// ParseWebhook verifies the signature of the webhook and decodes the event.
+	ParseWebhook(header http.Header, body []byte) (*PaymentEvent, error)
+}
+
+// FakePaymentSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body.
+const FakePaymentSignatureHeader = "X-Fake-Signature"
+
+// FakePaymentProvider is a local provider for development and tests, its webhooks
+// are PaymentEvent as JSON signed with a shared secret.
+type FakePaymentProvider struct {
+	secret []byte
+}
+
+func NewFakePaymentProvider(secret string) *FakePaymentProvider {
+	return &FakePaymentProvider{secret: []byte(secret)}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+// Sign returns the signature header value for the body.
+func (p *FakePaymentProvider) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakePaymentProvider) ParseWebhook(header http.Header, body []byte) (*PaymentEvent, error) {
+	signature := header.Get(FakePaymentSignatureHeader)
+	if !strings.HasPrefix(signature, "sha256=") || !hmac.Equal([]byte(signature), []byte(p.Sign(body))) {
+		return nil, ErrInvalidSignature
+	}
+	var event PaymentEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.ID == "" || event.SubscriptionID == "" || event.UserID == 0 {
+		return nil, errors.New("event id, subscription id and user id are required")
+	}
+	return &event, nil
+}
+
+var paymentProviders = map[string]PaymentProvider{}
+
+func RegisterPaymentProvider(provider PaymentProvider) {
+	paymentProviders[provider.Name()] = provider
+}
+
+func GetPaymentProvider(name string) (PaymentProvider, bool) {
+	provider, ok := paymentProviders[name]
+	return provider, ok
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakePaymentProviderParseWebhook(t *testing.T) {
+	provider := NewFakePaymentProvider("secret")
+	body := []byte(`{"id":"evt_1","type":"subscription.active","user_id":1,"plan":"premium","subscription_id":"sub_1","expires_at":"2030-01-01T00:00:00Z"}`)
+	signed := func(signature string) http.Header {
+		header := http.Header{}
+		if signature != "" {
+			header.Set(FakePaymentSignatureHeader, signature)
+		}
+		return header
+	}
+
+	event, err := provider.ParseWebhook(signed(provider.Sign(body)), body)
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	assert.Equal(t, uint(1), event.UserID)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), event.ExpiresAt.UTC())
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+	}{
+		{"missing signature", signed(""), body},
+		{"signed with another secret", signed(NewFakePaymentProvider("other").Sign(body)), body},
+		{"tampered body", signed(provider.Sign(body)), []byte(`{"id":"evt_1","type":"subscription.active","user_id":2,"plan":"premium","subscription_id":"sub_1","expires_at":"2030-01-01T00:00:00Z"}`)},
+		{"without prefix", signed(provider.Sign(body)[len("sha256="):]), body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.ParseWebhook(tt.header, tt.body)
+			assert.ErrorIs(t, err, ErrInvalidSignature)
+		})
+	}
+
+	incomplete := []byte(`{"id":"evt_2","type":"subscription.active","plan":"premium"}`)
+	_, err = provider.ParseWebhook(signed(provider.Sign(incomplete)), incomplete)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidSignature)
+}
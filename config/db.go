@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/ilyaDyb/go_rest_api/geo"
 	"github.com/ilyaDyb/go_rest_api/logger"
 	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/joho/godotenv"
@@ -16,6 +17,9 @@ import (
 
 var DB *gorm.DB
 
+// Spatial is the distance index of the users table, PostGIS when available.
+var Spatial geo.SpatialIndex
+
 func init() {
     if err := godotenv.Load(); err != nil {
         log.Print("No .env file found")
@@ -41,22 +45,89 @@ func Connect() {
     logger.Log.WithFields(logrus.Fields{
         "service": "postgres",
     }).Info("Postgres was started successfully")
+    // messages read before read_at was introduced only have is_read, they are
+    // backfilled once, by the start which adds the column
+    backfillReadAt := DB.Migrator().HasTable(&models.Message{}) && !DB.Migrator().HasColumn(&models.Message{}, "read_at")
+    migrate()
+    if backfillReadAt {
+        backfillReadReceipts()
+    }
+    // history is paginated by (created_at, id) and the last message is looked up per chat
+    createIndex("idx_messages_chat_created_id", "CREATE INDEX IF NOT EXISTS idx_messages_chat_created_id ON messages (chat_id, created_at, id)")
+    // full-text search of messages, the expression must match repository.PostgresMessageSearcher
+    createIndex("idx_messages_content_fts", "CREATE INDEX IF NOT EXISTS idx_messages_content_fts ON messages USING GIN (to_tsvector('simple', content))")
+    setupSpatial()
+}
+
+func ConnectTestDB()  {
+    var err error
+    dsn := "file:test.db?mode=memory&cache=shared"
+    DB, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+    if err != nil {
+        log.Fatalf("could not connect to the test database: %v", err.Error())
+    }
+    log.Println("Test database connected successfully")
+    migrate()
+    Spatial, err = geo.NewSpatialIndex(DB)
+    if err != nil {
+        log.Fatalf("could not prepare the spatial index: %v", err.Error())
+    }
+}
+
+// migrate creates or updates the tables of all models.
+func migrate() {
     DB.AutoMigrate(
         &models.User{},
         &models.Photo{},
         &models.UserInteraction{},
         &models.Chat{},
         &models.Message{},
+        &models.MessageEdit{},
+        &models.MessageHide{},
+        &models.Attachment{},
+        &models.Block{},
+        &models.Report{},
+        &models.DiscoveryPreferences{},
+        &models.Subscription{},
+        &models.PaymentEvent{},
+        &models.RecoveryCode{},
+        &models.LinkedIdentity{},
     )
 }
 
-func ConnectTestDB()  {
+// createIndex builds an index AutoMigrate can't express. The server works without
+// it, only slower, so a failure is logged instead of stopping the start.
+func createIndex(name string, sql string) {
+    if err := DB.Exec(sql).Error; err != nil {
+        logger.Log.WithFields(logrus.Fields{
+            "service": "postgres",
+            "index":   name,
+        }).Errorf("could not create index, queries using it fall back to scans: %v", err)
+    }
+}
+
+func backfillReadReceipts() {
+    result := DB.Exec("UPDATE messages SET read_at = updated_at WHERE is_read = true AND read_at IS NULL")
+    if result.Error != nil {
+        logger.Log.WithFields(logrus.Fields{
+            "service": "postgres",
+        }).Errorf("could not backfill read_at of read messages: %v", result.Error)
+        return
+    }
+    logger.Log.WithFields(logrus.Fields{
+        "service": "postgres",
+    }).Infof("read_at was backfilled for %d read messages", result.RowsAffected)
+}
+
+func setupSpatial() {
     var err error
-    dsn := "file:test.db?mode=memory&cache=shared"
-    DB, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+    Spatial, err = geo.NewSpatialIndex(DB)
     if err != nil {
-        log.Fatalf("could not connect to the test database: %v", err.Error())
+        logger.Log.WithFields(logrus.Fields{
+            "service": "spatial",
+        }).Fatalf("could not prepare the spatial index: %v", err)
     }
-    log.Println("Test database connected successfully")
-    DB.AutoMigrate(&models.User{})
+    logger.Log.WithFields(logrus.Fields{
+        "service": "spatial",
+    }).Infof("Using %s spatial index", Spatial.Name())
 }
\ No newline at end of file
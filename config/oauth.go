@@ -0,0 +1,49 @@
+package config
+
+import (
+	"context"
+	"os"
+
+	"github.com/ilyaDyb/go_rest_api/api"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func oauthRedirectURL(provider string) string {
+	return ServerProtocol + ServerHost + "/auth/oauth/" + provider + "/callback"
+}
+
+// LoadOAuthProviders registers social login providers which have credentials in env.
+// OAUTH_OIDC_ISSUER allows to plug any OpenID Connect issuer, e.g. a local mock one.
+func LoadOAuthProviders() {
+	if clientID := os.Getenv("OAUTH_GOOGLE_CLIENT_ID"); clientID != "" {
+		api.RegisterOAuthProvider(api.NewOIDCProvider(
+			"google",
+			clientID,
+			os.Getenv("OAUTH_GOOGLE_CLIENT_SECRET"),
+			oauthRedirectURL("google"),
+			api.GoogleEndpoints,
+		))
+	}
+	if issuer := os.Getenv("OAUTH_OIDC_ISSUER"); issuer != "" {
+		name := os.Getenv("OAUTH_OIDC_NAME")
+		if name == "" {
+			name = "oidc"
+		}
+		provider, err := api.DiscoverOIDCProvider(
+			context.Background(),
+			name,
+			issuer,
+			os.Getenv("OAUTH_OIDC_CLIENT_ID"),
+			os.Getenv("OAUTH_OIDC_CLIENT_SECRET"),
+			oauthRedirectURL(name),
+		)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"service": "oauth",
+			}).Errorf("could not load oidc provider: %v, with error: %v", issuer, err.Error())
+			return
+		}
+		api.RegisterOAuthProvider(provider)
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+import (
+	"os"
+
+	"github.com/ilyaDyb/go_rest_api/api"
+)
+
+// LoadPaymentProviders registers payment providers which have credentials in env.
+// PAYMENTS_FAKE_SECRET enables the local fake provider.
+func LoadPaymentProviders() {
+	if secret := os.Getenv("PAYMENTS_FAKE_SECRET"); secret != "" {
+		api.RegisterPaymentProvider(api.NewFakePaymentProvider(secret))
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"slices"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+)
+
+const (
+	PlanFree    = "free"
+	PlanPlus    = "plus"
+	PlanPremium = "premium"
+)
+
+// Unlimited is the daily limit of an action which is not limited.
+const Unlimited = -1
+
+// BoostDuration is how long a boost keeps the user at the top of feeds.
+const BoostDuration = 30 * time.Minute
+
+// TimezoneChangeInterval is how often users may change the timezone, every change
+// moves the midnight of the daily limits and could start a new day early.
+const TimezoneChangeInterval = 7 * 24 * time.Hour
+
+// PlanLimits are the daily limits and entitlements of a plan, the days start
+// at midnight in the user's timezone.
+type PlanLimits struct {
+	DailyLikes      int64
+	DailySuperlikes int64
+	DailyRewinds    int64
+	DailyBoosts     int64
+	// RewindWindow is how long after a dislike it can still be rewound
+	RewindWindow time.Duration
+	// Entitlements are the paid features of the plan
+	Entitlements []string
+}
+
+func (p PlanLimits) Has(entitlement string) bool {
+	return slices.Contains(p.Entitlements, entitlement)
+}
+
+var Plans = map[string]PlanLimits{
+	PlanFree: {
+		DailyLikes:      10,
+		DailySuperlikes: 1,
+	},
+	PlanPlus: {
+		DailyLikes:      10,
+		DailySuperlikes: 3,
+		DailyRewinds:    10,
+		RewindWindow:    time.Hour,
+		Entitlements:    []string{models.EntitlementUnlimitedLikes, models.EntitlementRewind},
+	},
+	PlanPremium: {
+		DailyLikes:      10,
+		DailySuperlikes: 5,
+		DailyRewinds:    Unlimited,
+		DailyBoosts:     1,
+		RewindWindow:    24 * time.Hour,
+		Entitlements: []string{
+			models.EntitlementUnlimitedLikes,
+			models.EntitlementSeeLikes,
+			models.EntitlementRewind,
+			models.EntitlementBoost,
+		},
+	},
+}
+
+// LimitsOf returns the limits of the plan, unknown plans get the free limits.
+func LimitsOf(plan string) PlanLimits {
+	if limits, ok := Plans[plan]; ok {
+		return limits
+	}
+	return Plans[PlanFree]
+}
+
+func IsValidPlan(plan string) bool {
+	_, ok := Plans[plan]
+	return ok
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RankingPoolSize is the number of candidates loaded for the profile feed,
+// the whole pool is ranked before it's split into pages.
+const RankingPoolSize = 300
+
+// RankingWeights are the weights of the profile feed scorers by scorer name,
+// a scorer with zero weight is switched off.
+var RankingWeights = map[string]float64{
+	"distance":     0.3,
+	"hobbies":      0.25,
+	"age":          0.15,
+	"activity":     0.2,
+	"completeness": 0.1,
+	// candidates who superliked the viewer
+	"superlike": 0.5,
+	// boosted candidates
+	"boost": 1,
+}
+
+// LoadRankingWeights overrides RankingWeights from RANKING_WEIGHTS,
+// e.g. RANKING_WEIGHTS="distance=0.5,hobbies=0.5,activity=0".
+func LoadRankingWeights() error {
+	value := os.Getenv("RANKING_WEIGHTS")
+	if value == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("invalid ranking weight %q, expected name=weight", pair)
+		}
+		if _, known := RankingWeights[name]; !known {
+			return fmt.Errorf("unknown ranking scorer %q", name)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return fmt.Errorf("invalid weight for ranking scorer %q", name)
+		}
+		RankingWeights[name] = w
+	}
+	return nil
+}
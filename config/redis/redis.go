@@ -14,7 +14,7 @@ import (
 const RedisAddr = "localhost:6379"
 
 var (
-	Client *asynq.Client
+	Client      *asynq.Client
 	RedisClient *redis.Client
 )
 
@@ -38,8 +38,8 @@ func StartRedis() error {
 
 	mux := asynq.NewServeMux()
 	mux.HandleFunc("email:deliver", tasks.HandleEmailDeliveryTask)
-	mux.HandleFunc("messages:reader", tasks.HandleReadMessagesTask)
-	
+	mux.HandleFunc(tasks.TypePurgeUser, tasks.HandlePurgeUserTask)
+
 	log.Println("Starting Asynq server...")
 	if err := srv.Run(mux); err != nil {
 		logger.Log.WithFields(logrus.Fields{
@@ -50,4 +50,3 @@ func StartRedis() error {
 	}
 	return nil
 }
-
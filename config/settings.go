@@ -1,9 +1,34 @@
 package config
 
+import (
+	"os"
+	"strings"
+	"time"
+)
+
 const (
 	DefaultUploadPath = "./uploads/"
 	UserPhotoPath     = DefaultUploadPath + "user_photos/"
+	AttachmentPath    = DefaultUploadPath + "attachments/"
 	RedisAddr         = "localhost:6379"
-	ServerHost		  = "localhost:8080"
-	ServerProtocol	  = "http://"
-)
\ No newline at end of file
+	ServerHost        = "localhost:8080"
+	ServerProtocol    = "http://"
+	TOTPIssuer        = "TinderClone"
+)
+
+// AccountDeletionGracePeriod is the time between the deletion request and the purge,
+// logging in during this period cancels the deletion.
+const AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// TrustedProxies returns the reverse proxies from TRUSTED_PROXIES (comma separated
+// ips or CIDRs) whose X-Forwarded-For is used as the client ip. Without them only
+// the remote address is used, so per-ip lockouts can't be bypassed with the header.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/ilyaDyb/go_rest_api/tasks"
+	"github.com/sirupsen/logrus"
+)
+
+// reactivateAccount is called on every successful login, so logging in
+// during the grace period also cancels the scheduled deletion.
+func reactivateAccount(userService *service.UserService, user *models.User) error {
+	if !user.IsDeactivated && user.DeletionScheduledAt == nil {
+		return nil
+	}
+	user.IsDeactivated = false
+	user.DeletionScheduledAt = nil
+	if err := userService.UpdateUser(user); err != nil {
+		return err
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "user",
+		"username":  user.Username,
+	}).Info("account was reactivated by login")
+	return nil
+}
+
+// touchLastActive records the activity used by the feed ranking, a failure
+// must not break the login.
+func touchLastActive(userService *service.UserService, user *models.User) {
+	if err := userService.TouchLastActive(user.ID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  user.Username,
+		}).Errorf("could not update last activity with error: %v", err.Error())
+	}
+}
+
+// reauthWindow is how long after the login a session of an account without
+// password and 2FA may confirm sensitive actions.
+const reauthWindow = 10 * time.Minute
+
+// ReauthInput confirms sensitive actions: accounts with password send it,
+// accounts created through social login send the 2FA code when it is enabled.
+type ReauthInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// reauthenticate responds with 401 unless the request proves a recent login of
+// the owner, a stolen access token alone must not be enough for sensitive actions.
+// Accounts without password and 2FA have nothing to check, so their session must
+// have been started within reauthWindow, e.g. by logging in with the provider again.
+func reauthenticate(c *gin.Context, userService *service.UserService, sessionService *service.SessionService, user *models.User, input ReauthInput) bool {
+	if user.Password != "" {
+		if err := user.CheckPassword(input.Password); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return false
+		}
+		return true
+	}
+	if user.TwoFactorEnabled {
+		ok, err := checkSecondFactor(userService, user, input.Code)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "auth",
+				"service":   "gorm",
+				"username":  user.Username,
+			}).Errorf("databse service could not check second factor with error: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return false
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+			return false
+		}
+		return true
+	}
+	session, err := sessionService.GetSession(c.GetString("session_id"))
+	if err != nil || session.Username != user.Username || time.Since(session.CreatedAt) > reauthWindow {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Log in again to confirm this action", "reauth_required": true})
+		return false
+	}
+	return true
+}
+
+// @Summary Deactivate account
+// @Tags user
+// @Description Hides the profile from other users and logs out everywhere, the next login reactivates the account
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param input body ReauthInput true "The password, or the 2FA code for accounts without password"
+// @Success 200 {object} utils.MessageResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /u/deactivate [post]
+func (ctrl *UserController) DeactivateAccountController(c *gin.Context) {
+	var input ReauthInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !reauthenticate(c, &ctrl.userService, &ctrl.sessionService, user, input) {
+		return
+	}
+	user.IsDeactivated = true
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+		}).Errorf("databse service could not deactivate user: %v, with err: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not deactivate account"})
+		return
+	}
+	ctrl.revokeAllSessions(username)
+	c.JSON(http.StatusOK, gin.H{"message": "Account was deactivated, log in to restore it"})
+}
+
+// @Summary Delete account
+// @Tags user
+// @Description Deactivates the account and deletes all its data after the grace period, logging in during the period cancels the deletion
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param input body ReauthInput true "The password, or the 2FA code for accounts without password"
+// @Success 202 {object} utils.MessageResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /u/delete [post]
+func (ctrl *UserController) DeleteAccountController(c *gin.Context) {
+	var input ReauthInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !reauthenticate(c, &ctrl.userService, &ctrl.sessionService, user, input) {
+		return
+	}
+
+	deleteAt := time.Now().Add(config.AccountDeletionGracePeriod)
+	user.IsDeactivated = true
+	user.DeletionScheduledAt = &deleteAt
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+		}).Errorf("databse service could not schedule deletion of user: %v, with err: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not schedule account deletion"})
+		return
+	}
+	task, err := tasks.NewPurgeUserTask(user.ID)
+	if err == nil {
+		_, err = redis.Client.Enqueue(task, asynq.ProcessAt(deleteAt))
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "asynq",
+		}).Errorf("server could not schedule purge of user: %v, with err: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not schedule account deletion"})
+		return
+	}
+	ctrl.revokeAllSessions(username)
+	logger.Log.WithFields(logrus.Fields{
+		"component": "user",
+		"username":  username,
+		"delete_at": deleteAt,
+	}).Info("user scheduled account deletion")
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":   "Account will be deleted, log in before this date to cancel the deletion",
+		"delete_at": deleteAt,
+	})
+}
+
+func (ctrl *UserController) revokeAllSessions(username string) {
+	if err := ctrl.sessionService.DeleteUserSessions(username); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "redis",
+			"username":  username,
+		}).Errorf("server could not revoke sessions with error: %v", err.Error())
+	}
+}
+
+// @Summary Export user data
+// @Tags user
+// @Description Downloads a ZIP archive with the profile, photos, interactions and messages of the user
+// @Accept json
+// @Produce application/zip
+// @Param Authorization header string true "With the Bearer started"
+// @Param input body ReauthInput true "The password, or the 2FA code for accounts without password"
+// @Success 200 {file} file
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /u/export [post]
+func (ctrl *UserController) ExportDataController(c *gin.Context) {
+	var input ReauthInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	if !allowRequest(c, "export:"+username, 3, time.Hour) {
+		return
+	}
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !reauthenticate(c, &ctrl.userService, &ctrl.sessionService, user, input) {
+		return
+	}
+	interactions, err := ctrl.userService.GetUserInteractions(user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+		}).Errorf("databse service could not get interactions of user: %v, with err: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not export data"})
+		return
+	}
+	messages, err := ctrl.chatService.GetUserMessages(user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+		}).Errorf("databse service could not get messages of user: %v, with err: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not export data"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", username+"_export.zip"))
+	c.Status(http.StatusOK)
+	// the archive is streamed, after the first byte the status can't be changed anymore
+	if err := writeUserExport(c.Writer, user, interactions, *messages); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("server could not write export archive with error: %v", err.Error())
+	}
+}
+
+func writeUserExport(w io.Writer, user *models.User, interactions []models.UserInteraction, messages []models.Message) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"interactions.json", interactions},
+		{"messages.json", messages},
+	}
+	for _, f := range files {
+		file, err := archive.Create(f.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	for _, photo := range user.Photo {
+		if err := addFileToArchive(archive, photo.URL, "photos/"+filepath.Base(photo.URL)); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func addFileToArchive(archive *zip.Writer, path string, name string) error {
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
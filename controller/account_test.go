@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reauthAs runs reauthenticate in the request of the session and returns its
+// result with the response.
+func reauthAs(ctrl *UserController, user *models.User, sessionID string, input ReauthInput) (bool, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Set("username", user.Username)
+	c.Set("session_id", sessionID)
+	return reauthenticate(c, &ctrl.userService, &ctrl.sessionService, user, input), w
+}
+
+func newTestSession(t *testing.T, ctrl *UserController, user models.User, createdAt time.Time) string {
+	t.Helper()
+	session := models.Session{ID: user.Username + "_session", Username: user.Username, CreatedAt: createdAt}
+	require.NoError(t, ctrl.sessionService.CreateSession(&session, time.Hour))
+	return session.ID
+}
+
+func TestReauthenticateWithPassword(t *testing.T) {
+	ctrl := newTestUserController()
+	user := createTestUser(t, "reauth_password")
+	require.NoError(t, user.HashPassword("secret"))
+	// a fresh session doesn't replace the password
+	sessionID := newTestSession(t, ctrl, user, time.Now())
+
+	ok, w := reauthAs(ctrl, &user, sessionID, ReauthInput{})
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	ok, w = reauthAs(ctrl, &user, sessionID, ReauthInput{Password: "wrong"})
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	ok, _ = reauthAs(ctrl, &user, sessionID, ReauthInput{Password: "secret"})
+	assert.True(t, ok)
+}
+
+func TestReauthenticateSocialAccountWithTwoFactor(t *testing.T) {
+	ctrl := newTestUserController()
+	user := createTestUser(t, "reauth_two_factor")
+	user.TwoFactorEnabled = true
+	require.NoError(t, config.DB.Save(&user).Error)
+	recovery := models.RecoveryCode{UserID: user.ID, CodeHash: utils.GetSHA256Hash("abcde-fghjk")}
+	require.NoError(t, config.DB.Create(&recovery).Error)
+	sessionID := newTestSession(t, ctrl, user, time.Now())
+
+	ok, w := reauthAs(ctrl, &user, sessionID, ReauthInput{})
+	assert.False(t, ok, "a fresh session is not enough when 2FA is enabled")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	ok, _ = reauthAs(ctrl, &user, sessionID, ReauthInput{Code: "abcde-fghjk"})
+	assert.True(t, ok)
+
+	ok, w = reauthAs(ctrl, &user, sessionID, ReauthInput{Code: "abcde-fghjk"})
+	assert.False(t, ok, "recovery codes are one-time")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestReauthenticateSocialAccountNeedsRecentLogin(t *testing.T) {
+	ctrl := newTestUserController()
+	fresh := createTestUser(t, "reauth_social_fresh")
+	stale := createTestUser(t, "reauth_social_stale")
+	freshSession := newTestSession(t, ctrl, fresh, time.Now())
+	staleSession := newTestSession(t, ctrl, stale, time.Now().Add(-reauthWindow-time.Minute))
+
+	ok, _ := reauthAs(ctrl, &fresh, freshSession, ReauthInput{})
+	assert.True(t, ok)
+
+	ok, w := reauthAs(ctrl, &stale, staleSession, ReauthInput{})
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "reauth_required")
+
+	// the session of another user doesn't count
+	ok, _ = reauthAs(ctrl, &stale, freshSession, ReauthInput{})
+	assert.False(t, ok)
+}
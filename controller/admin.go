@@ -1,10 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
 	"github.com/ilyaDyb/go_rest_api/logger"
 	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/ilyaDyb/go_rest_api/service"
@@ -13,12 +17,14 @@ import (
 )
 
 type AdminController struct {
-	userService service.UserService
-    chatService service.ChatService
+	userService         service.UserService
+	chatService         service.ChatService
+	moderationService   service.ModerationService
+	subscriptionService service.SubscriptionService
 }
 
-func NewAdminController(userService service.UserService, chatService service.ChatService) *AdminController {
-    return &AdminController{userService: userService, chatService: chatService}
+func NewAdminController(userService service.UserService, chatService service.ChatService, moderationService service.ModerationService, subscriptionService service.SubscriptionService) *AdminController {
+	return &AdminController{userService: userService, chatService: chatService, moderationService: moderationService, subscriptionService: subscriptionService}
 }
 
 // UsersList godoc
@@ -26,47 +32,48 @@ func NewAdminController(userService service.UserService, chatService service.Cha
 // @Description Get a list of users with pagination
 // @Tags admin
 // @Produce json
+// @Param Authorization header string true "With the Bearer started"
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
 // @Success 200 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
 // @Router /admin/users [get]
 func (ctrl *AdminController) UsersList(c *gin.Context) {
-    limitStr := c.DefaultQuery("limit", "10")
-    pageStr := c.DefaultQuery("page", "1")
-    limit, err := strconv.Atoi(limitStr)
-    if err != nil {
-        limit = 10
-    }
-    page, err := strconv.Atoi(pageStr)
-    if err != nil {
-        page = 1
-    }
-
-    users, err := ctrl.userService.GetAllUsers(limit, (page-1)*limit)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("failed to get all users with error: %v", err.Error())
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
-        return
-    }
-    total, err := ctrl.userService.GetUsersCount()
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("failed to get users count with error: %v", err.Error())
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users count"})
-        return
-    }
-    totalPages := (total + limit - 1) / limit
-
-    c.JSON(http.StatusOK, gin.H{
-        "users":      users,
-        "page":       page,
-        "totalPages": totalPages,
-        "total":      total,
-    })
+	limitStr := c.DefaultQuery("limit", "10")
+	pageStr := c.DefaultQuery("page", "1")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 10
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil {
+		page = 1
+	}
+
+	users, err := ctrl.userService.GetAllUsers(limit, (page-1)*limit)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to get all users with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	total, err := ctrl.userService.GetUsersCount()
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to get users count with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users count"})
+		return
+	}
+	totalPages := (total + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":      users,
+		"page":       page,
+		"totalPages": totalPages,
+		"total":      total,
+	})
 }
 
 // GetPutPostDeleteUser godoc
@@ -74,32 +81,33 @@ func (ctrl *AdminController) UsersList(c *gin.Context) {
 // @Description Get a user by ID
 // @Tags admin
 // @Produce json
+// @Param Authorization header string true "With the Bearer started"
 // @Param id path int true "User ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /admin/user/{id} [get]
 func (ctrl *AdminController) GetUser(c *gin.Context) {
-    idStr := c.Param("id")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.AbortWithStatus(http.StatusBadRequest)
-        return
-    }
-
-    user, err := ctrl.userService.GetUserByID(uint(id))
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.AbortWithStatus(http.StatusInternalServerError)
-        return
-    }
-
-    c.JSON(http.StatusOK, user)
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	user, err := ctrl.userService.GetUserByID(uint(id))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
 }
 
 // DeleteUser godoc
@@ -107,129 +115,159 @@ func (ctrl *AdminController) GetUser(c *gin.Context) {
 // @Description Delete a user by ID
 // @Tags admin
 // @Produce json
+// @Param Authorization header string true "With the Bearer started"
 // @Param id path int true "User ID"
 // @Success 204
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /admin/user/{id} [delete]
 func (ctrl *AdminController) DeleteUser(c *gin.Context) {
-    idStr := c.Param("id")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.AbortWithStatus(http.StatusBadRequest)
-        return
-    }
-
-    user, err := ctrl.userService.GetUserByID(uint(id))
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.AbortWithStatus(http.StatusInternalServerError)
-        return
-    }
-
-    if err := ctrl.userService.DeleteUser(user); err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    c.Status(http.StatusNoContent)
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	user, err := ctrl.userService.GetUserByID(uint(id))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := ctrl.userService.DeleteUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 // UpdateUser godoc
 // @Summary Update a user by ID
-// @Description Update a user by ID
+// @Description Update a user by ID, a new email is applied after the owner confirms it
 // @Tags admin
 // @Produce json
+// @Param Authorization header string true "With the Bearer started"
 // @Param id path int true "User ID"
 // @Param input body models.User true "User info"
 // @Success 204
+// @Success 202 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /admin/user/{id} [put]
 func (ctrl *AdminController) UpdateUser(c *gin.Context) {
-    idStr := c.Param("id")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.AbortWithStatus(http.StatusBadRequest)
-        return
-    }
-
-    user, err := ctrl.userService.GetUserByID(uint(id))
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.AbortWithStatus(http.StatusInternalServerError)
-        return
-    }
-
-    type ChangeProfileInput struct {
-        Email     string `form:"email"`
-        Firstname string `form:"firstname"`
-        Lastname  string `form:"lastname"`
-        Age       string `form:"age"`
-        Country   string `form:"country"`
-        City      string `form:"city"`
-        Bio       string `form:"bio"`
-        Hobbies   string `form:"hobbies"`
-    }
-    var input ChangeProfileInput
-    err = c.ShouldBindJSON(&input)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        return
-    }
-
-    if input.Firstname != "" {
-        user.Firstname = input.Firstname
-    }
-    if input.Email != "" {
-        user.Email = input.Email
-    }
-    if input.Lastname != "" {
-        user.Lastname = input.Lastname
-    }
-    if input.Age != "0" {
-        age, err := strconv.Atoi(input.Age)
-        if err != nil {
-            c.Status(http.StatusBadRequest)
-            return
-        }
-        user.Age = uint8(age)
-    }
-    if input.Country != "" {
-        user.Country = input.Country
-    }
-    if input.City != "" {
-        user.City = input.City
-    }
-    if input.Bio != "" {
-        user.Bio = input.Bio
-    }
-    if input.Hobbies != "" {
-        user.Hobbies = input.Hobbies
-    }
-
-    if err := ctrl.userService.UpdateUser(user); err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("with error: %v", err.Error())
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update user profile"})
-        return
-    }
-    c.Status(http.StatusNoContent)
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	user, err := ctrl.userService.GetUserByID(uint(id))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	type ChangeProfileInput struct {
+		Email     string `form:"email"`
+		Firstname string `form:"firstname"`
+		Lastname  string `form:"lastname"`
+		Age       string `form:"age"`
+		Country   string `form:"country"`
+		City      string `form:"city"`
+		Bio       string `form:"bio"`
+		Hobbies   string `form:"hobbies"`
+	}
+	var input ChangeProfileInput
+	err = c.ShouldBindJSON(&input)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		return
+	}
+
+	if input.Firstname != "" {
+		user.Firstname = input.Firstname
+	}
+	if input.Lastname != "" {
+		user.Lastname = input.Lastname
+	}
+	if input.Age != "0" {
+		age, err := strconv.Atoi(input.Age)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		user.Age = uint8(age)
+	}
+	if input.Country != "" {
+		user.Country = input.Country
+	}
+	if input.City != "" {
+		user.City = input.City
+	}
+	if input.Bio != "" {
+		user.Bio = input.Bio
+	}
+	if input.Hobbies != "" {
+		user.Hobbies = input.Hobbies
+	}
+
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update user profile"})
+		return
+	}
+
+	// the email is changed only after the owner confirms the new address
+	if input.Email != "" && !strings.EqualFold(input.Email, user.Email) {
+		if !utils.IsValidEmailFormat(input.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email format is invalid"})
+			return
+		}
+		exists, err := ctrl.userService.IsExistsEmail(input.Email)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "admin",
+			}).Errorf("with error: %v", err.Error())
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			c.JSON(http.StatusConflict, gin.H{"error": "This email is already used by another account"})
+			return
+		}
+		if err := startEmailChange(&ctrl.userService, user, input.Email); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "admin",
+			}).Errorf("with error: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start email change"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Profile updated, email will be changed after confirmation from the new address"})
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 // CreateUser godoc
@@ -237,84 +275,431 @@ func (ctrl *AdminController) UpdateUser(c *gin.Context) {
 // @Description Create a new user
 // @Tags admin
 // @Produce json
+// @Param Authorization header string true "With the Bearer started"
 // @Param input body models.User true "User info"
 // @Success 201 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /admin/user [post]
 func (ctrl *AdminController) CreateUser(c *gin.Context) {
-    type createUserInput struct {
-        Username  string `json:"username" validate:"max=50"`
-        Email     string `json:"email" validate:"max=100"`
-        Password  string `json:"password" validate:"min=8,max=100"`
-        Firstname string `json:"firstname"`
-        Lastname  string `json:"lastname"`
-        Sex       string `json:"sex" validate:"oneof=male female"`
-        Role      string `json:"role" validate:"oneof=admin user"`
-        Age       uint8  `json:"age"`
-        Country   string `json:"country"`
-        City      string `json:"city"`
-        Hobbies   string `json:"hobbies"`
-    }
-
-    var input createUserInput
-    err := c.ShouldBindJSON(&input)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    err = utils.ValidateStruct(input)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
-        return
-    }
-
-    user := models.User{
-        Username:  input.Username,
-        Email:     input.Email,
-        Password:  input.Password,
-        Sex:       input.Sex,
-        Role:      input.Role,
-        Age:       input.Age,
-        Country:   input.Country,
-        City:      input.City,
-        Hobbies:   input.Hobbies,
-        Firstname: input.Firstname,
-        Lastname:  input.Lastname,
-        IsActive:  true,
-    }
-
-    err = user.HashPassword(input.Password)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("failed to hash password error: %v", err.Error())
-        c.Status(http.StatusInternalServerError)
-        return
-    }
-
-    err = ctrl.userService.CreateUser(&user)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "admin",
-        }).Errorf("failed to create user with error: %v", err.Error())
-        c.Status(http.StatusInternalServerError)
-        return
-    }
-
-    c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
+	type createUserInput struct {
+		Username  string `json:"username" validate:"max=50"`
+		Email     string `json:"email" validate:"max=100"`
+		Password  string `json:"password" validate:"min=8,max=100"`
+		Firstname string `json:"firstname"`
+		Lastname  string `json:"lastname"`
+		Sex       string `json:"sex" binding:"required,oneof=male female non_binary"`
+		Role      string `json:"role" validate:"oneof=admin support user"`
+		Age       uint8  `json:"age"`
+		Country   string `json:"country"`
+		City      string `json:"city"`
+		Hobbies   string `json:"hobbies"`
+	}
+
+	var input createUserInput
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = utils.ValidateStruct(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	user := models.User{
+		Username:  input.Username,
+		Email:     input.Email,
+		Password:  input.Password,
+		Sex:       input.Sex,
+		Role:      input.Role,
+		Age:       input.Age,
+		Country:   input.Country,
+		City:      input.City,
+		Hobbies:   input.Hobbies,
+		Firstname: input.Firstname,
+		Lastname:  input.Lastname,
+		IsActive:  true,
+	}
+
+	err = user.HashPassword(input.Password)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to hash password error: %v", err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	err = ctrl.userService.CreateUser(&user)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to create user with error: %v", err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
 
 // @Summary Get absolutely all chats
 // @Description Route which return all chats
 // @Tags admin
 // @Produce json
+// @Param Authorization header string true "With the Bearer started"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /admin/chats [get]
 func (ctrl *AdminController) GetAllChats(c *gin.Context) {
-    chats, _ := ctrl.chatService.GetAllChats()
-    c.JSON(200, chats)
-}
\ No newline at end of file
+	chats, _ := ctrl.chatService.GetAllChats()
+	c.JSON(200, chats)
+}
+
+// GetChatMessages godoc
+// @Summary Messages of a chat for moderation
+// @Description Returns original content of all messages, including edited and deleted ones, with edit history
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "Chat ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/chats/{id}/messages [get]
+func (ctrl *AdminController) GetChatMessages(c *gin.Context) {
+	chatID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	messages, err := ctrl.chatService.GetMessagesForModeration(uint(chatID))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("with error: %v", err.Error())
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "admin",
+		"admin":     c.MustGet("username").(string),
+		"chat_id":   chatID,
+	}).Info("moderator viewed chat messages")
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// ReportsQueue godoc
+// @Summary Moderation queue
+// @Description Reports with the given status, the oldest first
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param status query string false "open, resolved or dismissed" default(open)
+// @Param limit query int false "Limit"
+// @Param page query int false "Page"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/reports [get]
+func (ctrl *AdminController) ReportsQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ReportStatusOpen)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	reports, err := ctrl.moderationService.GetReports(status, limit, (page-1)*limit)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to get reports with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports"})
+		return
+	}
+	total, err := ctrl.moderationService.GetReportsCount(status)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to get reports count with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports":    reports,
+		"page":       page,
+		"totalPages": (int(total) + limit - 1) / limit,
+		"total":      total,
+	})
+}
+
+// GetReport godoc
+// @Summary Report with evidence
+// @Description Report with the original content and edit history of the evidence messages
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "Report ID"
+// @Success 200 {object} models.Report
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/reports/{id} [get]
+func (ctrl *AdminController) GetReport(c *gin.Context) {
+	reportID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	report, err := ctrl.moderationService.GetReportByID(uint(reportID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+type ResolveReportInput struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// ResolveReport godoc
+// @Summary Resolve report
+// @Description Takes the report out of the queue as resolved or dismissed
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "Report ID"
+// @Param ResolveReportInput body ResolveReportInput true "Resolution"
+// @Success 200 {object} models.Report
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/reports/{id} [patch]
+func (ctrl *AdminController) ResolveReport(c *gin.Context) {
+	reportID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	var input ResolveReportInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Status != models.ReportStatusResolved && input.Status != models.ReportStatusDismissed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be resolved or dismissed"})
+		return
+	}
+	admin, err := ctrl.userService.GetUserByUsername(c.MustGet("username").(string))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	report, err := ctrl.moderationService.GetReportByID(uint(reportID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+
+	now := time.Now()
+	report.Status = input.Status
+	report.ResolutionNote = input.Note
+	report.ResolvedByID = &admin.ID
+	report.ResolvedAt = &now
+	if err := ctrl.moderationService.UpdateReport(report); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to update report with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "admin",
+		"admin":     admin.Username,
+		"report_id": report.ID,
+		"status":    report.Status,
+	}).Info("report was resolved")
+	c.JSON(http.StatusOK, report)
+}
+
+// GetUserSubscriptions godoc
+// @Summary User subscriptions
+// @Description All subscriptions of the user, the newest first
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "User ID"
+// @Success 200 {array} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/user/{id}/subscriptions [get]
+func (ctrl *AdminController) GetUserSubscriptions(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	subscriptions, err := ctrl.subscriptionService.GetSubscriptions(uint(userID))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to get subscriptions with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get subscriptions"})
+		return
+	}
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+type GrantSubscriptionInput struct {
+	Plan string `json:"plan" binding:"required"`
+	Days int    `json:"days" binding:"required,min=1,max=3650"`
+}
+
+// GrantSubscription godoc
+// @Summary Grant plan
+// @Description Gives the user the plan for the number of days instead of the current subscriptions, no payment is involved
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "User ID"
+// @Param GrantSubscriptionInput body GrantSubscriptionInput true "Plan and duration"
+// @Success 201 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/user/{id}/subscription [post]
+func (ctrl *AdminController) GrantSubscription(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	var input GrantSubscriptionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	admin, err := ctrl.userService.GetUserByUsername(c.MustGet("username").(string))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if _, err := ctrl.userService.GetUserByID(uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	subscription, err := ctrl.subscriptionService.Grant(uint(userID), input.Plan, time.Duration(input.Days)*24*time.Hour, admin.ID)
+	if errors.Is(err, service.ErrUnknownPlan) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown plan " + input.Plan})
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to grant subscription with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant subscription"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component":  "admin",
+		"admin":      admin.Username,
+		"user_id":    userID,
+		"plan":       subscription.Plan,
+		"expires_at": subscription.ExpiresAt,
+	}).Info("subscription was granted")
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// RevokeSubscription godoc
+// @Summary Revoke plan
+// @Description Ends all active subscriptions of the user at once, billing at the payment provider is not canceled
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/user/{id}/subscription [delete]
+func (ctrl *AdminController) RevokeSubscription(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	admin, err := ctrl.userService.GetUserByUsername(c.MustGet("username").(string))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := ctrl.subscriptionService.Revoke(uint(userID)); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+		}).Errorf("failed to revoke subscription with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke subscription"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "admin",
+		"admin":     admin.Username,
+		"user_id":   userID,
+	}).Info("subscription was revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription revoked"})
+}
+
+type TwoFactorPolicyInput struct {
+	RequireForAdmins bool `json:"require_for_admins"`
+}
+
+// SetTwoFactorPolicy godoc
+// @Summary Require 2FA for admins
+// @Description Turns on or off mandatory two-factor authentication for admin accounts
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param input body TwoFactorPolicyInput true "Policy"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/settings/two-factor [put]
+func (ctrl *AdminController) SetTwoFactorPolicy(c *gin.Context) {
+	var input TwoFactorPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	value := "0"
+	if input.RequireForAdmins {
+		value = "1"
+	}
+	if err := utils.SetCache(redis.RedisClient, requireAdminTwoFactorKey, value, 0); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "admin",
+			"service":   "redis",
+		}).Errorf("failed to save two-factor policy with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save policy"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "admin",
+		"username":  c.GetString("username"),
+	}).Infof("two-factor requirement for admins was set to %v", input.RequireForAdmins)
+	c.JSON(http.StatusOK, gin.H{"require_for_admins": input.RequireForAdmins})
+}
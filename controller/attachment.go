@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/ws"
+	"github.com/sirupsen/logrus"
+)
+
+const maxVideoSize = 50 << 20
+
+// attachmentKinds maps sniffed MIME types to the attachment kind, everything else is rejected.
+var attachmentKinds = map[string]string{
+	"image/jpeg":      models.AttachmentImage,
+	"image/png":       models.AttachmentImage,
+	"image/webp":      models.AttachmentImage,
+	"image/heic":      models.AttachmentImage,
+	"image/gif":       models.AttachmentGIF,
+	"video/mp4":       models.AttachmentVideo,
+	"video/quicktime": models.AttachmentVideo,
+	"video/webm":      models.AttachmentVideo,
+	"audio/ogg":       models.AttachmentVoice,
+	"audio/mpeg":      models.AttachmentVoice,
+	"audio/mp4":       models.AttachmentVoice,
+	"audio/x-m4a":     models.AttachmentVoice,
+	"audio/aac":       models.AttachmentVoice,
+	"audio/wav":       models.AttachmentVoice,
+	"audio/amr":       models.AttachmentVoice,
+}
+
+var attachmentSizeLimits = map[string]int64{
+	models.AttachmentImage: 10 << 20,
+	models.AttachmentGIF:   10 << 20,
+	models.AttachmentVideo: maxVideoSize,
+	models.AttachmentVoice: 10 << 20,
+}
+
+// UploadAttachmentController godoc
+// @Summary Send an attachment
+// @Description Sends a message with an image, GIF, short video or voice note. The type is detected from the file content.
+// @Tags chat
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param Authorization header string true "With the Bearer started"
+// @Param chat_id formData int true "Chat ID"
+// @Param file formData file true "Attachment"
+// @Param content formData string false "Caption"
+// @Param client_msg_id formData string false "Client generated id for retries"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /chats/attachments [post]
+func (ctrl *ChatController) UploadAttachmentController(c *gin.Context) {
+	// the largest allowed file plus room for the other form fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVideoSize+1<<20)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	chatID, err := strconv.Atoi(c.PostForm("chat_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat_id"})
+		return
+	}
+
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	chat, err := ctrl.chatService.GetChatByID(uint(chatID))
+	if err != nil || !chat.HasMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not a member of this chat"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read file"})
+		return
+	}
+	mtype, err := mimetype.DetectReader(src)
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read file"})
+		return
+	}
+	kind, ok := attachmentKinds[mtype.String()]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported file type " + mtype.String()})
+		return
+	}
+	if file.Size > attachmentSizeLimits[kind] {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large for " + kind})
+		return
+	}
+
+	if _, err := os.Stat(config.AttachmentPath); os.IsNotExist(err) {
+		os.MkdirAll(config.AttachmentPath, os.ModePerm)
+	}
+	// the name is random so files can't be guessed from chat or user ids
+	filePath := filepath.Join(config.AttachmentPath, uuid.New().String()+mtype.Extension())
+	if err := c.SaveUploadedFile(file, filePath); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+			"username":  username,
+		}).Errorf("user could not upload attachment with err: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save file"})
+		return
+	}
+
+	message := models.Message{
+		ChatID:     chat.ID,
+		SenderID:   user.ID,
+		ReceiverID: chat.OtherMember(user.ID),
+		Content:    c.PostForm("content"),
+		Attachments: []models.Attachment{{
+			Kind:     kind,
+			MimeType: mtype.String(),
+			Size:     file.Size,
+			Path:     filePath,
+		}},
+	}
+	if clientMsgID := c.PostForm("client_msg_id"); clientMsgID != "" {
+		message.ClientMsgID = &clientMsgID
+	}
+
+	created, err := ctrl.chatService.CreateMessageOnce(&message)
+	if err != nil || !created {
+		// a retry of an already stored message keeps the first upload
+		os.Remove(filePath)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+			"chat_id":   chat.ID,
+			"sender_id": user.ID,
+		}).Errorf("Failed to create message with attachment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the message"})
+		return
+	}
+	if created {
+		ws.Publish(ws.EventMessageNew, message, message.SenderID, message.ReceiverID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message_id": message.ID, "created_at": message.CreatedAt, "attachments": message.Attachments})
+}
+
+// GetAttachmentController godoc
+// @Summary Download an attachment
+// @Description Only members of the chat can download its attachments, not after the chat was closed
+// @Tags chat
+// @Produce  octet-stream
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /chats/attachments/{id} [get]
+func (ctrl *ChatController) GetAttachmentController(c *gin.Context) {
+	attachmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment id"})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// strangers get the same 404 as for a missing attachment
+	attachment, err := ctrl.chatService.GetAttachmentByID(uint(attachmentID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+	message, err := ctrl.chatService.GetMessageByID(attachment.MessageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) || message.DeletedForEveryoneAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+	// closed chats are hidden from the members, so are their files
+	open, err := ctrl.isChatOpen(message)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+		}).Errorf("Failed to check the chat of attachment %d with error: %v", attachment.ID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the attachment"})
+		return
+	}
+	if !open {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+
+	c.Header("Content-Type", attachment.MimeType)
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.File(attachment.Path)
+}
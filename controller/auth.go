@@ -1,17 +1,22 @@
 package controller
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/ilyaDyb/go_rest_api/config"
 	"github.com/ilyaDyb/go_rest_api/config/redis"
 	"github.com/ilyaDyb/go_rest_api/logger"
 	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
 	"github.com/ilyaDyb/go_rest_api/service"
 	"github.com/ilyaDyb/go_rest_api/tasks"
 	"github.com/ilyaDyb/go_rest_api/utils"
@@ -19,11 +24,12 @@ import (
 )
 
 type AuthController struct {
-	userService service.UserService
+	userService    service.UserService
+	sessionService service.SessionService
 }
 
-func NewAuthController(userService service.UserService) *AuthController {
-	return &AuthController{userService: userService}
+func NewAuthController(userService service.UserService, sessionService service.SessionService) *AuthController {
+	return &AuthController{userService: userService, sessionService: sessionService}
 }
 
 type RegisterInput struct {
@@ -32,7 +38,7 @@ type RegisterInput struct {
 	Password  string `json:"password" binding:"required" validate:"min=8,max=100"`
 	Firstname string `json:"firstname" binding:"required" validate:"max=50"`
 	Lastname  string `json:"lastname" binding:"required" validate:"max=50"`
-	Sex       string `json:"sex" binding:"required" validate:"oneof=male female"`
+	Sex       string `json:"sex" binding:"required,oneof=male female non_binary"`
 	Age       uint8  `json:"age" binding:"required" validate:"min=18,max=99"`
 	Country   string `json:"country" binding:"required" validate:"max=50"`
 	City      string `json:"city" binding:"required" validate:"max=50"`
@@ -105,19 +111,24 @@ func (ctrl *AuthController) RegistrationController(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email format is invalid"})
 		return
 	}
-	confirmationHash := utils.GetMD5Hash(utils.RandStringRunes(20))
 	user := models.User{
-		Username:         input.Username,
-		Role:             "user",
-		Email:            input.Email,
-		Sex:              input.Sex,
-		Age:              input.Age,
-		Country:          input.Country,
-		City:             input.City,
-		Hobbies:          input.Hobbies,
-		Firstname:        input.Firstname,
-		Lastname:         input.Lastname,
-		ConfirmationHash: confirmationHash,
+		Username:  input.Username,
+		Role:      models.RoleUser,
+		Email:     input.Email,
+		Sex:       input.Sex,
+		Age:       input.Age,
+		Country:   input.Country,
+		City:      input.City,
+		Hobbies:   input.Hobbies,
+		Firstname: input.Firstname,
+		Lastname:  input.Lastname,
+	}
+	if err := newConfirmationHash(&user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+		}).Errorf("server could not generate confirmation hash with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
 	}
 
 	if err := user.HashPassword(input.Password); err != nil {
@@ -125,21 +136,7 @@ func (ctrl *AuthController) RegistrationController(c *gin.Context) {
 		return
 	}
 
-	msg := []byte(fmt.Sprintf("To: recipient@example.net\r\n"+
-		"Subject: Tinder-clone!\r\n"+
-		"\r\n"+
-		"Your link for confirming email %s%s/auth/confirm?hash=%s.\r\n", config.ServerProtocol, config.ServerHost, confirmationHash))
-	task, err := tasks.NewEmailDeliveryTask(input.Email, msg)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"component": "auth",
-			"service":   "asynq",
-		}).Errorf("server could not start email delivery task with error: %v", err.Error())
-		c.Status(http.StatusInternalServerError)
-		return
-	}
-	info, err := redis.Client.Enqueue(task)
-	if err != nil {
+	if err := sendConfirmationEmail(&user); err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
 			"service":   "asynq",
@@ -147,7 +144,6 @@ func (ctrl *AuthController) RegistrationController(c *gin.Context) {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
-	log.Printf("enqueued task: id=%s queue=%s", info.ID, info.Queue)
 
 	if err := ctrl.userService.CreateUser(&user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -159,6 +155,7 @@ func (ctrl *AuthController) RegistrationController(c *gin.Context) {
 // Login godoc
 // @Summary      Login a user
 // @Description  Login a user by providing a username and password.
+// @Description  Accounts with enabled 2FA get challenge_token which must be passed to /auth/login/2fa.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -186,55 +183,117 @@ func (ctrl *AuthController) LoginController(c *gin.Context) {
 		return
 	}
 
+	if rejectIfLocked(c, loginIPKey(c.ClientIP()), loginAccountKey(input.Username)) {
+		return
+	}
+
 	user, err := ctrl.userService.GetUserByUsername(input.Username)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
 			"service":   "gorm",
 		}).Errorf("databse service could not find user by username: %v, with err: %v", input.Username, err.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		registerFailedLogin(c, input.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
 	if err := user.CheckPassword(input.Password); err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "user",
-		}).Infof("user: %v tried to enter invalid password: %v, with err: %v", input.Username, input.Password, err.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			"username":  input.Username,
+			"ip":        c.ClientIP(),
+		}).Infof("user: %v tried to enter invalid password, with err: %v", input.Username, err.Error())
+		registerFailedLogin(c, input.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
-	token, err := utils.GenerateJWT(input.Username)
-	if err != nil {
+	if err := utils.ResetAttempts(redis.RedisClient, loginAccountKey(user.Username)); err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
-			"service":   "JWT",
-			"username":  input.Username,
-		}).Errorf("JWT service could not generate token by username: %v", input.Username)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			"service":   "redis",
+		}).Errorf("server could not reset failed attempts with error: %v", err.Error())
+	}
+	ctrl.completeLogin(c, user)
+}
+
+// startSession registers a new session for the user and responds with its token pair.
+func (ctrl *AuthController) startSession(c *gin.Context, user *models.User) {
+	if err := reactivateAccount(&ctrl.userService, user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  user.Username,
+		}).Errorf("databse service could not reactivate user with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
-	refreshToken, err := utils.GenerateRefreshToken(input.Username)
+	touchLastActive(&ctrl.userService, user)
+	session := models.Session{
+		ID:         uuid.NewString(),
+		Username:   user.Username,
+		RefreshID:  uuid.NewString(),
+		Device:     c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+	}
+	if err := ctrl.sessionService.CreateSession(&session, utils.RefreshTokenLifetime); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"username":  user.Username,
+		}).Errorf("server could not create session with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	token, refreshToken, err := generateTokenPair(user, &session)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
 			"service":   "JWT",
-			"username":  input.Username,
-		}).Errorf("JWT service could not generate refresh token by username: %v", input.Username)
+			"username":  user.Username,
+		}).Errorf("JWT service could not generate tokens by username: %v", user.Username)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
 }
 
+func generateTokenPair(user *models.User, session *models.Session) (string, string, error) {
+	token, err := utils.GenerateJWT(user.Username, user.Role, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := utils.GenerateRefreshToken(user.Username, session.ID, session.RefreshID)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// @Summary      JSON Web Key Set
+// @Description  Public keys which verify tokens issued by this server
+// @Tags         auth
+// @Produce      json
+// @Success      200         {object}  map[string]interface{}
+// @Router       /.well-known/jwks.json [get]
+func (ctrl *AuthController) JWKSController(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
+
 type InputRefresh struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // @Summary      Refreshing access Token
+// @Description  Rotates the refresh token. Reusing an already rotated refresh token revokes the whole session.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        InputRefresh  body      InputRefresh  true  "InputRefresh"
 // @Success      200         {object}  MessageResponse
+// @Failure      401         {object}  ErrorResponse
 // @Router       /auth/refresh [post]
 func (ctrl *AuthController) RefreshController(c *gin.Context) {
 	var input InputRefresh
@@ -251,7 +310,56 @@ func (ctrl *AuthController) RefreshController(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
-	newToken, err := utils.GenerateJWT(claims.Username)
+	session, err := ctrl.sessionService.GetSession(claims.SessionID)
+	if err != nil || session.Username != claims.Username {
+		logger.Log.WithFields(logrus.Fields{
+			"component":  "auth",
+			"service":    "redis",
+			"username":   claims.Username,
+			"session_id": claims.SessionID,
+		}).Info("client tried to refresh token of revoked session")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session was revoked"})
+		return
+	}
+	if session.RefreshID != claims.ID {
+		ctrl.revokeReusedSession(c, session)
+		return
+	}
+	user, err := ctrl.userService.GetUserByUsername(claims.Username)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+		}).Errorf("databse service could not find user by username: %v, with err: %v", claims.Username, err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	touchLastActive(&ctrl.userService, user)
+
+	session.RefreshID = uuid.NewString()
+	session.IP = c.ClientIP()
+	session.LastUsedAt = time.Now()
+	err = ctrl.sessionService.RotateSession(session, claims.ID, utils.RefreshTokenLifetime)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		// a concurrent refresh with the same token won
+		ctrl.revokeReusedSession(c, session)
+		return
+	}
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session was revoked"})
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"username":  user.Username,
+		}).Errorf("server could not rotate session with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	newToken, newRefreshToken, err := generateTokenPair(user, session)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
@@ -261,20 +369,141 @@ func (ctrl *AuthController) RefreshController(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": newToken})
+	c.JSON(http.StatusOK, gin.H{"token": newToken, "refresh_token": newRefreshToken})
 }
 
-// @Summary Change Password
-// @Description Change user password using verification code
+// revokeReusedSession ends the session whose refresh token was used after it had
+// been rotated, so somebody holds a copy of it.
+func (ctrl *AuthController) revokeReusedSession(c *gin.Context, session *models.Session) {
+	if err := ctrl.sessionService.DeleteSession(session); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+		}).Errorf("server could not revoke session with error: %v", err.Error())
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component":  "auth",
+		"username":   session.Username,
+		"session_id": session.ID,
+		"ip":         c.ClientIP(),
+	}).Warn("refresh token reuse detected, session was revoked")
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session was revoked"})
+}
+
+// @Summary      Logout
+// @Description  Revokes the session of the current access token
+// @Tags         auth
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Success      200         {object}  MessageResponse
+// @Failure      401         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/logout [post]
+func (ctrl *AuthController) LogoutController(c *gin.Context) {
+	session, err := ctrl.sessionService.GetSession(c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session was revoked"})
+		return
+	}
+	if err := ctrl.sessionService.DeleteSession(session); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"username":  session.Username,
+		}).Errorf("server could not revoke session with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// @Summary      Logout from all devices
+// @Description  Revokes every session of the current user
+// @Tags         auth
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Success      200         {object}  MessageResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/logout-all [post]
+func (ctrl *AuthController) LogoutAllController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	if err := ctrl.sessionService.DeleteUserSessions(username); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"username":  username,
+		}).Errorf("server could not revoke sessions with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions"})
+}
+
+// @Summary      Active sessions
+// @Description  Returns all active sessions of the current user
+// @Tags         auth
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/sessions [get]
+func (ctrl *AuthController) SessionsController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	sessions, err := ctrl.sessionService.GetUserSessions(username)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"username":  username,
+		}).Errorf("server could not get sessions with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":           sessions,
+		"current_session_id": c.GetString("session_id"),
+	})
+}
+
+// @Summary      Revoke session
+// @Description  Revokes one of the sessions of the current user
+// @Tags         auth
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path string true "Session ID"
+// @Success      200         {object}  MessageResponse
+// @Failure      404         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/sessions/{id} [delete]
+func (ctrl *AuthController) RevokeSessionController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	session, err := ctrl.sessionService.GetSession(c.Param("id"))
+	if err != nil || session.Username != username {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err := ctrl.sessionService.DeleteSession(session); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"username":  username,
+		}).Errorf("server could not revoke session with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session was revoked"})
+}
+
+// @Summary Confirm email
+// @Description Activates account by the link from registration email
 // @Tags auth
-// @Accept  json
 // @Produce  json
-// @Param   changePasswordInput body ChangePasswordInput true "Change Password Input"
+// @Param   hash query string true "Confirmation hash"
 // @Success 200 {object} MessageResponse
 // @Failure 400 {object} ErrorResponse
-// @Failure 409 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /auth/change-password [post]
+// @Router /auth/confirm [get]
 func (ctrl *AuthController) ConfirmEmailController(c *gin.Context) {
 	hash := c.Query("hash")
 	if hash == "" {
@@ -291,9 +520,18 @@ func (ctrl *AuthController) ConfirmEmailController(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No user with this hash"})
 		return
 	}
+	expiresAt := user.CreatedAt.Add(confirmationLifetime)
+	if user.ConfirmationExpiresAt != nil {
+		expiresAt = *user.ConfirmationExpiresAt
+	}
+	if time.Now().After(expiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Confirmation link expired, request a new one"})
+		return
+	}
 
 	user.IsActive = true
 	user.ConfirmationHash = ""
+	user.ConfirmationExpiresAt = nil
 	if err := ctrl.userService.UpdateUser(user); err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "user",
@@ -306,6 +544,127 @@ func (ctrl *AuthController) ConfirmEmailController(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Email was confirmed"})
 }
 
+// @Summary Resend confirmation email
+// @Description Sends a new confirmation link, the previous link stops working
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   email body EmailInput true "Email"
+// @Success 202 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/resend-confirmation [post]
+func (ctrl *AuthController) ResendConfirmationController(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !utils.IsValidEmailFormat(input.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+	if !allowRequest(c, "resend_confirmation:ip:"+c.ClientIP(), 20, time.Hour) ||
+		!allowRequest(c, "resend_confirmation:"+strings.ToLower(input.Email), 1, 2*time.Minute) {
+		return
+	}
+
+	// the response is the same for unknown and already confirmed emails,
+	// so the endpoint can't be used to find out registered addresses
+	accepted := gin.H{"message": "If the account is waiting for confirmation, check your email"}
+	user, err := ctrl.userService.GetUserByEmail(input.Email)
+	if err != nil || user.IsActive {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err := newConfirmationHash(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+		}).Errorf("server could not generate confirmation hash with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+		}).Errorf("databse service could not save confirmation hash with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := sendConfirmationEmail(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "asynq",
+		}).Errorf("server could not start email delivery with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// @Summary Confirm email change
+// @Description Applies pending email change by the link sent to the new address
+// @Tags auth
+// @Produce  json
+// @Param   hash query string true "Email change hash"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/confirm-email-change [get]
+func (ctrl *AuthController) ConfirmEmailChangeController(c *gin.Context) {
+	hash := c.Query("hash")
+	if hash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hash is required"})
+		return
+	}
+	user, err := ctrl.userService.GetUserByEmailChangeHash(hash)
+	if err != nil || user.PendingEmail == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending email change with this hash"})
+		return
+	}
+	if time.Now().After(user.EmailChangeExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Confirmation link expired, request the change again"})
+		return
+	}
+	exists, err := ctrl.userService.IsExistsEmail(user.PendingEmail)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+		}).Errorf("databse service could not check email with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "This email is already used by another account"})
+		return
+	}
+
+	oldEmail := user.Email
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	user.EmailChangeHash = ""
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+		}).Errorf("databse service could not change email with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "auth",
+		"username":  user.Username,
+		"old_email": oldEmail,
+		"new_email": user.Email,
+	}).Info("user changed email")
+	c.JSON(http.StatusOK, gin.H{"message": "Email was changed"})
+}
+
 type ConfirmEmailResponse struct {
 	Message string `json:"message"`
 }
@@ -334,6 +693,10 @@ func (ctrl *AuthController) DropPasswordController(c *gin.Context) {
 		return
 	}
 	email := input.Email
+	if !allowRequest(c, "password_reset:ip:"+c.ClientIP(), 10, time.Hour) ||
+		!allowRequest(c, resetCodeKey(email), 3, 15*time.Minute) {
+		return
+	}
 	if !utils.IsValidEmailFormat(email) {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
@@ -405,7 +768,11 @@ func (ctrl *AuthController) DropPasswordController(c *gin.Context) {
 	}
 	ID := strconv.Itoa(int(user.ID))
 
-	err = utils.SetCache(redis.RedisClient, code, ID, time.Minute*3)
+	// the code is stored under the email, so the same code of another user can't reset this account
+	err = utils.SetCache(redis.RedisClient, resetCodeKey(email), ID+":"+utils.GetSHA256Hash(code), resetCodeLifetime)
+	if err == nil {
+		err = utils.DeleteCache(redis.RedisClient, resetCodeAttemptsKey(email))
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
@@ -417,13 +784,14 @@ func (ctrl *AuthController) DropPasswordController(c *gin.Context) {
 	}
 	logger.Log.WithFields(logrus.Fields{
 		"component": "auth",
-	}).Infof("email sent successfully with code: %v to: %v, with id: %v", code, email, ID)
+	}).Infof("email sent successfully to: %v, with id: %v", email, ID)
 	c.JSON(http.StatusAccepted, gin.H{"message": "check your email"})
 }
 
 type ChangePasswordInput struct {
-	Code        string `json:"code"`
-	NewPassword string `json:"password"`
+	Email       string `json:"email" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"password" binding:"required"`
 }
 
 // @Summary Change Password
@@ -435,6 +803,7 @@ type ChangePasswordInput struct {
 // @Success 200 {object} MessageResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /auth/change-password [post]
 func (ctrl *AuthController) ChangePassword(c *gin.Context) {
@@ -443,28 +812,61 @@ func (ctrl *AuthController) ChangePassword(c *gin.Context) {
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
-		}).Errorf("client sent bad data: %v, with error: %v", input, err.Error())
+		}).Errorf("client sent bad data with error: %v", err.Error())
 		log.Printf("Error binding input: %v\n", err)
 		c.Status(http.StatusBadRequest)
 		return
 	}
-	log.Printf("Received code: %s, new password: %s\n", input.Code, input.NewPassword)
+	ipKey := "password_reset:ip:" + c.ClientIP()
+	if rejectIfLocked(c, ipKey) {
+		return
+	}
+	if !utils.IsValidPassword(input.NewPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be >= 8 chars long and contain number"})
+		return
+	}
 
-	userID, err := utils.GetCache(redis.RedisClient, input.Code)
+	stored, err := utils.GetCache(redis.RedisClient, resetCodeKey(input.Email))
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
 			"service":   "redis",
-		}).Errorf("getting cache was failed by key: %v or 3 minutes have passed since the code was sent to the email, with error: %v", input.Code, err.Error())
+		}).Errorf("getting reset code was failed for email: %v or 3 minutes have passed since the code was sent to the email, with error: %v", input.Email, err.Error())
+		registerFailedAttempt(c, ipKey, ipLockoutPolicy)
 		c.JSON(http.StatusConflict, gin.H{"error": "internal server error or 3 minutes have passed since the code was sent to the email"})
 		return
 	}
+	userID, codeHash, _ := strings.Cut(stored, ":")
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(utils.GetSHA256Hash(input.Code))) != 1 {
+		registerFailedAttempt(c, ipKey, ipLockoutPolicy)
+		attempts, err := redis.RedisClient.Incr(c, resetCodeAttemptsKey(input.Email)).Result()
+		if err == nil && attempts == 1 {
+			redis.RedisClient.Expire(c, resetCodeAttemptsKey(input.Email), resetCodeLifetime)
+		}
+		if err == nil && attempts >= maxResetCodeAttempts {
+			// too many guesses, the code is burned and user has to request a new one
+			utils.DeleteCache(redis.RedisClient, resetCodeKey(input.Email))
+			logger.Log.WithFields(logrus.Fields{
+				"component": "auth",
+				"event":     "lockout",
+				"email":     input.Email,
+				"ip":        c.ClientIP(),
+				"attempts":  attempts,
+			}).Warn("password reset code was invalidated after too many attempts")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, request a new code"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+	utils.DeleteCache(redis.RedisClient, resetCodeKey(input.Email))
+	utils.DeleteCache(redis.RedisClient, resetCodeAttemptsKey(input.Email))
 
 	var user models.User
 	if err := config.DB.Model(&models.User{}).Where("id = ?", userID).First(&user).Error; err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "auth",
-		}).Errorf("client sent bad data: %v, with error: %v", input, err.Error())
+		}).Errorf("client sent bad data: %v, with error: %v", input.Email, err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
 		return
 	}
@@ -496,6 +898,14 @@ func (ctrl *AuthController) ChangePassword(c *gin.Context) {
 		return
 	}
 
+	if err := ctrl.sessionService.DeleteUserSessions(user.Username); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"user_id":   userID,
+		}).Errorf("Failed to revoke sessions after password change: %v", err)
+	}
+
 	logger.Log.WithFields(logrus.Fields{
 		"component": "auth",
 		"user_id":   userID,
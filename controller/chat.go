@@ -1,27 +1,35 @@
 package controller
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/ilyaDyb/go_rest_api/config/redis"
 	"github.com/ilyaDyb/go_rest_api/logger"
 	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
 	"github.com/ilyaDyb/go_rest_api/service"
-	"github.com/ilyaDyb/go_rest_api/tasks"
+	"github.com/ilyaDyb/go_rest_api/ws"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type ChatController struct {
-	chatService service.ChatService
-	userService service.UserService
+	chatService       service.ChatService
+	userService       service.UserService
+	searchService     service.SearchService
+	moderationService service.ModerationService
 }
 
-func NewChatController(chatService service.ChatService, userService service.UserService) *ChatController {
+func NewChatController(chatService service.ChatService, userService service.UserService, searchService service.SearchService, moderationService service.ModerationService) *ChatController {
 	return &ChatController{
-		chatService: chatService,
-		userService: userService,
+		chatService:       chatService,
+		userService:       userService,
+		searchService:     searchService,
+		moderationService: moderationService,
 	}
 }
 
@@ -57,7 +65,11 @@ func NewChatController(chatService service.ChatService, userService service.User
 // @Tags chat
 // @Produce json
 // @Param Authorization header string true "With the Bearer started"
+// @Description Messages are paginated with before_id (older messages, the default is the latest page) or after_id (newer messages)
 // @Param username path string true "Target Username"
+// @Param before_id query int false "Return messages older than this message"
+// @Param after_id query int false "Return messages newer than this message"
+// @Param limit query int false "Page size, 50 by default, at most 100"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Router /chats/{username} [get]
@@ -71,6 +83,12 @@ func (ctrl *ChatController) ChatController(c *gin.Context) {
         return
     }
 
+    page, err := messagePageFromQuery(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
     username := c.MustGet("username").(string)
     if username == targetUsername {
         c.JSON(http.StatusBadRequest, gin.H{"error": "you can't join a chat with yourself"})
@@ -86,62 +104,13 @@ func (ctrl *ChatController) ChatController(c *gin.Context) {
         return
     }
 
-    lastMessage, err := ctrl.chatService.GetLastMessageByChatID(chat.ID)
-    if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "chat",
-        }).Errorf("Failed to get last message with error: %v", err.Error())
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get last message"})
-        return
-    }
-
     curUsr, err := ctrl.userService.GetUserByUsername(username)
     if err != nil {
-        logger.Log.WithFields(logrus.Fields{
-            "component": "chat",
-        }).Errorf("Failed to get current user with error: %v", err.Error())
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get current user"})
+        c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
         return
     }
-	log.Println(lastMessage.SenderID, curUsr.ID)
-    if lastMessage.SenderID != curUsr.ID {
-        // task, err := tasks.NewReadMessagesTask(chat.ID, curUsr.ID)
-		// log.Println(string(task.Payload()))
-        // if err != nil {
-        //     logger.Log.WithFields(logrus.Fields{
-        //         "component": "chat",
-        //     }).Errorf("Failed to create read messages task with error: %v", err.Error())
-        //     c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create read messages task"})
-        //     return
-        // }
-
-        // inf, err = redis.Client.Enqueue(task)
-		// if err != nil {
-		// 	log.Panicln(err.Error())
-		// }
-		// log.Println(inf)
-		task, err := tasks.NewReadMessagesTask(chat.ID, lastMessage.SenderID)
-		if err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"component": "chat",
-				"service":   "asynq",
-			}).Errorf("server could not start messages reader task with error: %v", err.Error())
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		info, err := redis.Client.Enqueue(task)
-		if err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"component": "chat",
-				"service":   "asynq",
-			}).Errorf("server could not start messages reader with error: %v", err.Error())
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		log.Printf("enqueued task: id=%s queue=%s", info.ID, info.Queue)
-	}
 
-    messages, err := ctrl.chatService.GetMessagesByIDChat(chat.ID)
+    messages, hasMore, err := ctrl.chatService.GetMessagesByIDChat(chat.ID, curUsr.ID, page)
     if err != nil {
         logger.Log.WithFields(logrus.Fields{
             "component": "chat",
@@ -153,12 +122,42 @@ func (ctrl *ChatController) ChatController(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{
         "chat_members": chat,
         "messages": messages,
+        "has_more": hasMore,
     })
 }
 
+const (
+    defaultMessagePageSize = 50
+    maxMessagePageSize     = 100
+)
+
+func messagePageFromQuery(c *gin.Context) (repository.MessagePage, error) {
+    page := repository.MessagePage{Limit: defaultMessagePageSize}
+    if limit := c.Query("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil || n <= 0 {
+            return page, errors.New("limit must be a positive number")
+        }
+        page.Limit = min(n, maxMessagePageSize)
+    }
+    for param, dst := range map[string]*uint{"before_id": &page.BeforeID, "after_id": &page.AfterID} {
+        if value := c.Query(param); value != "" {
+            id, err := strconv.ParseUint(value, 10, 64)
+            if err != nil {
+                return page, fmt.Errorf("invalid %s", param)
+            }
+            *dst = uint(id)
+        }
+    }
+    if page.BeforeID != 0 && page.AfterID != 0 {
+        return page, errors.New("before_id and after_id can't be used together")
+    }
+    return page, nil
+}
+
 // ChatController godoc
 // @Summary Get all chats for current user
-// @Description Route which return all chats for current user
+// @Description Route which return all chats for current user, the most recently active first
 // @Tags chat
 // @Produce json
 // @Param Authorization header string true "With the Bearer started"
@@ -181,14 +180,62 @@ func (ctrl *ChatController) GetChatsForSpecUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get chats for special user"})
 		return
 	}
+	for i := range *chats {
+		chat := &(*chats)[i]
+		chat.Presence = ws.PresenceOf(chat.UserID, chat.HidePresence)
+	}
 	c.JSON(http.StatusOK, chats)
 }
 
 
+const maxSearchResults = 50
+
+// SearchMessagesController godoc
+// @Summary Search messages
+// @Description Full-text search of messages in the chats of the current user, matches in snippets are wrapped with <mark></mark>
+// @Tags chat
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param q query string true "Search query"
+// @Param limit query int false "Number of results, 20 by default, at most 50"
+// @Success 200 {array} utils.MessageSearchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /chats/search [get]
+func (ctrl *ChatController) SearchMessagesController(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	results, err := ctrl.searchService.SearchMessages(user.ID, query, min(limit, maxSearchResults))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+		}).Errorf("Failed to search messages for user: %v with error: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search messages"})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// receiver is taken from the chat, the client only says where to send
 type SendMessageInput struct {
-	ChatID     uint   `json:"chat_id" binding:"required"`
-	ReceiverID uint   `json:"receiver_id" binding:"required"`
-	Message    string `json:"message" binding:"required"`
+	ChatID  uint   `json:"chat_id" binding:"required"`
+	Message string `json:"message" binding:"required"`
+	// optional, retries with the same id don't create duplicates
+	ClientMsgID string `json:"client_msg_id" binding:"max=64"`
 }
 
 // SendMessage godoc
@@ -199,8 +246,9 @@ type SendMessageInput struct {
 // @Produce  json
 // @Param Authorization header string true "With the Bearer started"
 // @Param SendMessageInput body SendMessageInput true "Message input data"
-// @Success 200 {string} string "Message sent successfully"
+// @Success 200 {object} map[string]interface{} "Id of the stored message"
 // @Failure 400 {object} string "Invalid input data"
+// @Failure 403 {object} string "Not a member of the chat"
 // @Failure 404 {object} string "User not found"
 // @Failure 500 {object} string "Failed to create the message"
 // @Router /chats/message [post]
@@ -224,25 +272,263 @@ func (ctrl *ChatController) SendMessage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	chat, err := ctrl.chatService.GetChatByID(input.ChatID)
+	if err != nil || !chat.HasMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not a member of this chat"})
+		return
+	}
 
 	message := models.Message{
 		ChatID:    input.ChatID,
 		SenderID:  user.ID,
-		ReceiverID: input.ReceiverID,
+		ReceiverID: chat.OtherMember(user.ID),
 		Content:   input.Message,
 		IsRead:    false,
 	}
 
-	if err := ctrl.chatService.CreateMessage(&message); err != nil {
+	if input.ClientMsgID != "" {
+		message.ClientMsgID = &input.ClientMsgID
+	}
+
+	created, err := ctrl.chatService.CreateMessageOnce(&message)
+	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "chat",
 			"chat_id":   input.ChatID,
 			"sender_id": user.ID,
-			"receiver_id": input.ReceiverID,
+			"receiver_id": message.ReceiverID,
 		}).Errorf("Failed to create message: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create the message"})
 		return 
 	}
+	if created {
+		ws.Publish(ws.EventMessageNew, message, message.SenderID, message.ReceiverID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message_id": message.ID, "created_at": message.CreatedAt})
+}
+
+type MarkReadInput struct {
+	ChatID    uint `json:"chat_id" binding:"required"`
+	MessageID uint `json:"message_id" binding:"required"`
+}
+
+// MarkReadController godoc
+// @Summary Mark messages as read
+// @Description Marks all messages received in the chat up to message_id as read and notifies the sender
+// @Tags chat
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "With the Bearer started"
+// @Param MarkReadInput body MarkReadInput true "Chat and the last read message"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /chats/read [post]
+func (ctrl *ChatController) MarkReadController(c *gin.Context) {
+	var input MarkReadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	chat, err := ctrl.chatService.GetChatByID(input.ChatID)
+	if err != nil || !chat.HasMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not a member of this chat"})
+		return
+	}
+	if err := ws.MarkRead(ctrl.chatService, chat, user.ID, input.MessageID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark messages as read"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type EditMessageInput struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// EditMessageController godoc
+// @Summary Edit a message
+// @Description The sender can edit a message within 15 minutes, the previous content is kept for moderators
+// @Tags chat
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "Message ID"
+// @Param EditMessageInput body EditMessageInput true "New content"
+// @Success 200 {object} models.Message
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /chats/message/{id} [patch]
+func (ctrl *ChatController) EditMessageController(c *gin.Context) {
+	var input EditMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
+	user, message, ok := ctrl.memberMessage(c)
+	if !ok {
+		return
+	}
+	if err := ctrl.chatService.EditMessage(message, user.ID, input.Content); err != nil {
+		ctrl.respondMessageChangeError(c, err)
+		return
+	}
+	ws.Publish(ws.EventMessageEdit, message, message.SenderID, message.ReceiverID)
+	c.JSON(http.StatusOK, message)
+}
+
+// DeleteMessageController godoc
+// @Summary Delete a message
+// @Description for=me hides the message only for the current user, for=everyone leaves a tombstone for both members (sender only, within an hour)
+// @Tags chat
+// @Produce  json
+// @Param Authorization header string true "With the Bearer started"
+// @Param id path int true "Message ID"
+// @Param for query string false "me or everyone" default(me)
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /chats/message/{id} [delete]
+func (ctrl *ChatController) DeleteMessageController(c *gin.Context) {
+	scope := c.DefaultQuery("for", "me")
+	if scope != "me" && scope != "everyone" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "for must be 'me' or 'everyone'"})
+		return
+	}
+	user, message, ok := ctrl.memberMessage(c)
+	if !ok {
+		return
+	}
+	payload := ws.DeletedPayload{ChatID: message.ChatID, MessageID: message.ID, ForEveryone: scope == "everyone"}
+	if payload.ForEveryone {
+		if err := ctrl.chatService.DeleteMessageForEveryone(message, user.ID); err != nil {
+			ctrl.respondMessageChangeError(c, err)
+			return
+		}
+		ws.Publish(ws.EventMessageDel, payload, message.SenderID, message.ReceiverID)
+	} else {
+		if err := ctrl.chatService.DeleteMessageForMe(message, user.ID); err != nil {
+			ctrl.respondMessageChangeError(c, err)
+			return
+		}
+		ws.Publish(ws.EventMessageDel, payload, user.ID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// memberMessage loads the message from the path and checks that the current user is a member of its chat.
+func (ctrl *ChatController) memberMessage(c *gin.Context) (*models.User, *models.Message, bool) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return nil, nil, false
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, nil, false
+	}
+	message, err := ctrl.chatService.GetMessageByID(uint(messageID))
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return nil, nil, false
+	}
+	open, err := ctrl.isChatOpen(message)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+		}).Errorf("Failed to check the chat of message %d with error: %v", message.ID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the message"})
+		return nil, nil, false
+	}
+	if !open {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the chat is closed"})
+		return nil, nil, false
+	}
+	return user, message, true
+}
+
+// isChatOpen reports whether the members of the message's chat can still reach each
+// other: the chat isn't closed by unmatch or block and neither of them blocked the other.
+func (ctrl *ChatController) isChatOpen(message *models.Message) (bool, error) {
+	if _, err := ctrl.chatService.GetChatByID(message.ChatID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	blocked, err := ctrl.moderationService.IsBlocked(message.SenderID, message.ReceiverID)
+	return !blocked, err
+}
+
+func (ctrl *ChatController) respondMessageChangeError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrNotMessageSender:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case service.ErrMessageDeleted, service.ErrEditWindowExpired:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+		}).Errorf("Failed to change message with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change the message"})
+	}
+}
+
+type UnmatchInput struct {
+	ChatID uint `json:"chat_id" binding:"required"`
+}
 
-	c.Status(http.StatusOK)
+// UnmatchController godoc
+// @Summary Unmatch
+// @Description Closes the chat, it disappears for both users
+// @Tags chat
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "With the Bearer started"
+// @Param UnmatchInput body UnmatchInput true "Chat to close"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /chats/unmatch [post]
+func (ctrl *ChatController) UnmatchController(c *gin.Context) {
+	var input UnmatchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	chat, err := ctrl.chatService.GetChatByID(input.ChatID)
+	if err != nil || !chat.HasMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not a member of this chat"})
+		return
+	}
+	if err := closeChats(&ctrl.chatService, user.ID, chat.OtherMember(user.ID)); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+			"chat_id":   chat.ID,
+		}).Errorf("Failed to close chat with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close the chat"})
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/ilyaDyb/go_rest_api/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publishedEvents collects the events the hub would push to clients.
+type publishedEvents struct {
+	mu     sync.Mutex
+	events []ws.BrokerMessage
+}
+
+func capturePublished(t *testing.T) *publishedEvents {
+	t.Helper()
+	published := &publishedEvents{}
+	broker := ws.NewMemoryBroker()
+	require.NoError(t, broker.Subscribe(func(msg ws.BrokerMessage) {
+		published.mu.Lock()
+		defer published.mu.Unlock()
+		published.events = append(published.events, msg)
+	}))
+	previous := ws.HubInstance.Broker
+	ws.HubInstance.Broker = broker
+	t.Cleanup(func() { ws.HubInstance.Broker = previous })
+	return published
+}
+
+func (p *publishedEvents) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events)
+}
+
+func newTestChatController() *ChatController {
+	db := config.DB
+	return NewChatController(
+		service.NewChatService(repository.NewPostgresChatRepo(db)),
+		service.NewUserService(repository.NewPostgresUserRepo(db)),
+		service.NewSearchService(repository.NewMessageSearcher(db)),
+		service.NewModerationService(repository.NewPostgresModerationRepo(db)),
+	)
+}
+
+func createTestUser(t *testing.T, username string) models.User {
+	t.Helper()
+	user := models.User{Username: username, Email: username + "@example.com", Role: models.RoleUser, IsActive: true}
+	require.NoError(t, config.DB.Create(&user).Error)
+	return user
+}
+
+// newTestChat creates two users with a chat and a message from the sender.
+func newTestChat(t *testing.T, prefix string) (models.User, models.User, models.Message) {
+	t.Helper()
+	sender := createTestUser(t, prefix+"_sender")
+	receiver := createTestUser(t, prefix+"_receiver")
+	chat := models.Chat{User1ID: sender.ID, User2ID: receiver.ID}
+	require.NoError(t, config.DB.Create(&chat).Error)
+	message := models.Message{ChatID: chat.ID, SenderID: sender.ID, ReceiverID: receiver.ID, Content: "hello"}
+	require.NoError(t, config.DB.Create(&message).Error)
+	return sender, receiver, message
+}
+
+func serveAs(username string, method string, path string, body string, route string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		c.Set("username", username)
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMessageChangesInClosedChats(t *testing.T) {
+	ctrl := newTestChatController()
+	edit := func(username string, message models.Message) *httptest.ResponseRecorder {
+		return serveAs(username, http.MethodPatch, fmt.Sprintf("/chats/message/%d", message.ID),
+			`{"content": "edited"}`, "/chats/message/:id", ctrl.EditMessageController)
+	}
+	remove := func(username string, message models.Message) *httptest.ResponseRecorder {
+		return serveAs(username, http.MethodDelete, fmt.Sprintf("/chats/message/%d?for=everyone", message.ID),
+			"", "/chats/message/:id", ctrl.DeleteMessageController)
+	}
+
+	t.Run("open chat", func(t *testing.T) {
+		published := capturePublished(t)
+		sender, _, message := newTestChat(t, "open")
+		assert.Equal(t, http.StatusOK, edit(sender.Username, message).Code)
+		assert.Equal(t, http.StatusNoContent, remove(sender.Username, message).Code)
+		assert.Equal(t, 2, published.count())
+	})
+
+	t.Run("unmatched", func(t *testing.T) {
+		published := capturePublished(t)
+		sender, receiver, message := newTestChat(t, "unmatched")
+		_, err := ctrl.chatService.CloseChat(receiver.ID, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, edit(sender.Username, message).Code)
+		assert.Equal(t, http.StatusForbidden, remove(sender.Username, message).Code)
+		assert.Zero(t, published.count())
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		published := capturePublished(t)
+		sender, receiver, message := newTestChat(t, "blocked")
+		require.NoError(t, config.DB.Create(&models.Block{BlockerID: receiver.ID, BlockedID: sender.ID}).Error)
+		assert.Equal(t, http.StatusForbidden, edit(sender.Username, message).Code)
+		assert.Equal(t, http.StatusForbidden, remove(sender.Username, message).Code)
+		assert.Zero(t, published.count())
+
+		stored, err := ctrl.chatService.GetMessageByID(message.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", stored.Content)
+		assert.Nil(t, stored.DeletedForEveryoneAt)
+	})
+}
+
+func TestAttachmentsOfClosedChats(t *testing.T) {
+	ctrl := newTestChatController()
+	download := func(username string, attachment models.Attachment) int {
+		return serveAs(username, http.MethodGet, fmt.Sprintf("/chats/attachments/%d", attachment.ID),
+			"", "/chats/attachments/:id", ctrl.GetAttachmentController).Code
+	}
+	newAttachment := func(t *testing.T, prefix string) (models.User, models.User, models.Attachment) {
+		sender, receiver, message := newTestChat(t, prefix)
+		path := filepath.Join(t.TempDir(), "photo.png")
+		require.NoError(t, os.WriteFile(path, []byte("png"), 0o600))
+		attachment := models.Attachment{MessageID: message.ID, Kind: "image", MimeType: "image/png", Size: 3, Path: path}
+		require.NoError(t, config.DB.Create(&attachment).Error)
+		return sender, receiver, attachment
+	}
+
+	sender, receiver, attachment := newAttachment(t, "attachment_open")
+	assert.Equal(t, http.StatusOK, download(receiver.Username, attachment))
+	assert.Equal(t, http.StatusOK, download(sender.Username, attachment))
+
+	sender, receiver, attachment = newAttachment(t, "attachment_unmatched")
+	_, err := ctrl.chatService.CloseChat(sender.ID, receiver.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, download(receiver.Username, attachment))
+
+	sender, receiver, attachment = newAttachment(t, "attachment_blocked")
+	require.NoError(t, config.DB.Create(&models.Block{BlockerID: sender.ID, BlockedID: receiver.ID}).Error)
+	assert.Equal(t, http.StatusNotFound, download(receiver.Username, attachment))
+}
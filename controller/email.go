@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/ilyaDyb/go_rest_api/tasks"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	confirmationLifetime = 24 * time.Hour
+	emailChangeLifetime  = 24 * time.Hour
+)
+
+// sendEmail enqueues the email to the asynq "email:deliver" handler.
+func sendEmail(to string, subject string, body string) error {
+	msg := []byte(fmt.Sprintf("To: %s\r\n"+
+		"Subject: %s\r\n"+
+		"\r\n"+
+		"%s\r\n", to, subject, body))
+	task, err := tasks.NewEmailDeliveryTask(to, msg)
+	if err != nil {
+		return err
+	}
+	info, err := redis.Client.Enqueue(task)
+	if err != nil {
+		return err
+	}
+	log.Printf("enqueued task: id=%s queue=%s", info.ID, info.Queue)
+	return nil
+}
+
+func serverURL(path string) string {
+	return config.ServerProtocol + config.ServerHost + path
+}
+
+// emailTokenBytes is the entropy of confirmation and email change links.
+const emailTokenBytes = 32
+
+// newConfirmationHash replaces the previous confirmation link of the user.
+func newConfirmationHash(user *models.User) error {
+	hash, err := utils.RandomToken(emailTokenBytes)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(confirmationLifetime)
+	user.ConfirmationHash = hash
+	user.ConfirmationExpiresAt = &expiresAt
+	return nil
+}
+
+func sendConfirmationEmail(user *models.User) error {
+	return sendEmail(user.Email, "Tinder-clone!", fmt.Sprintf(
+		"Your link for confirming email %s. The link expires in 24 hours.",
+		serverURL("/auth/confirm?hash="+user.ConfirmationHash),
+	))
+}
+
+// startEmailChange keeps the new email as pending until it is confirmed from the
+// new address, the current address only gets a notice.
+func startEmailChange(userService *service.UserService, user *models.User, newEmail string) error {
+	hash, err := utils.RandomToken(emailTokenBytes)
+	if err != nil {
+		return err
+	}
+	user.PendingEmail = newEmail
+	user.EmailChangeHash = hash
+	user.EmailChangeExpiresAt = time.Now().Add(emailChangeLifetime)
+	if err := userService.UpdateUser(user); err != nil {
+		return err
+	}
+
+	if err := sendEmail(newEmail, "Tinder-clone: confirm your new email", fmt.Sprintf(
+		"Your link for confirming new email %s. The link expires in 24 hours.",
+		serverURL("/auth/confirm-email-change?hash="+user.EmailChangeHash),
+	)); err != nil {
+		return err
+	}
+	if err := sendEmail(user.Email, "Tinder-clone: email change requested", fmt.Sprintf(
+		"We received a request to change the email of your account %s to %s. "+
+			"The change will be applied only after it is confirmed from the new address. "+
+			"If it wasn't you, change your password.",
+		user.Username, newEmail,
+	)); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "asynq",
+			"username":  user.Username,
+		}).Errorf("server could not send email change notice with error: %v", err.Error())
+	}
+	return nil
+}
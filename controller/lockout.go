@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	accountLockoutPolicy = utils.LockoutPolicy{
+		MaxAttempts: 5,
+		Window:      15 * time.Minute,
+		BaseLock:    time.Minute,
+		MaxLock:     time.Hour,
+	}
+	ipLockoutPolicy = utils.LockoutPolicy{
+		MaxAttempts: 20,
+		Window:      15 * time.Minute,
+		BaseLock:    5 * time.Minute,
+		MaxLock:     24 * time.Hour,
+	}
+)
+
+const (
+	resetCodeLifetime    = 3 * time.Minute
+	maxResetCodeAttempts = 5
+)
+
+func loginAccountKey(username string) string {
+	return "login:user:" + strings.ToLower(username)
+}
+
+func loginIPKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func resetCodeKey(email string) string {
+	return "password_reset:" + strings.ToLower(email)
+}
+
+func resetCodeAttemptsKey(email string) string {
+	return "password_reset_attempts:" + strings.ToLower(email)
+}
+
+// rejectIfLocked responds with 429 if any of the keys is locked. Redis errors are
+// only logged, so an outage of redis doesn't block logins.
+func rejectIfLocked(c *gin.Context, keys ...string) bool {
+	for _, key := range keys {
+		ttl, err := utils.GetLockout(redis.RedisClient, key)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "auth",
+				"service":   "redis",
+				"lock_key":  key,
+			}).Errorf("server could not check lockout with error: %v", err.Error())
+			continue
+		}
+		if ttl > 0 {
+			seconds := int(ttl.Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("too many attempts, try again in %d seconds", seconds)})
+			return true
+		}
+	}
+	return false
+}
+
+func registerFailedAttempt(c *gin.Context, key string, policy utils.LockoutPolicy) {
+	duration, err := utils.RegisterFailedAttempt(redis.RedisClient, key, policy)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"lock_key":  key,
+		}).Errorf("server could not register failed attempt with error: %v", err.Error())
+		return
+	}
+	if duration > 0 {
+		logger.Log.WithFields(logrus.Fields{
+			"component":    "auth",
+			"event":        "lockout",
+			"lock_key":     key,
+			"ip":           c.ClientIP(),
+			"lock_seconds": int(duration.Seconds()),
+		}).Warn("too many failed attempts, key was locked")
+	}
+}
+
+func registerFailedLogin(c *gin.Context, username string) {
+	registerFailedAttempt(c, loginAccountKey(username), accountLockoutPolicy)
+	registerFailedAttempt(c, loginIPKey(c.ClientIP()), ipLockoutPolicy)
+}
+
+// allowRequest responds with 429 when the rate limit for the key is exceeded.
+func allowRequest(c *gin.Context, key string, limit int64, window time.Duration) bool {
+	allowed, err := utils.AllowRequest(redis.RedisClient, key, limit, window)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+			"rate_key":  key,
+		}).Errorf("server could not check rate limit with error: %v", err.Error())
+		return true
+	}
+	if !allowed {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"event":     "rate_limit",
+			"rate_key":  key,
+			"ip":        c.ClientIP(),
+		}).Warn("rate limit exceeded")
+		c.Header("Retry-After", strconv.Itoa(int(window.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, try again later"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/sirupsen/logrus"
+)
+
+func magicLinkKey(linkID string) string {
+	return "magic_link:" + linkID
+}
+
+// @Summary      Request magic link
+// @Description  Sends a single-use login link to the email, the link expires in 15 minutes
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        email body EmailInput true "Email"
+// @Success      202 {object} MessageResponse
+// @Failure      400 {object} ErrorResponse
+// @Failure      429 {object} ErrorResponse
+// @Failure      500 {object} ErrorResponse
+// @Router       /auth/magic-link [post]
+func (ctrl *AuthController) RequestMagicLinkController(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !utils.IsValidEmailFormat(input.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+	if !allowRequest(c, "magic_link:ip:"+c.ClientIP(), 10, time.Hour) ||
+		!allowRequest(c, "magic_link:email:"+strings.ToLower(input.Email), 3, 15*time.Minute) {
+		return
+	}
+
+	// unknown and inactive emails get the same response
+	accepted := gin.H{"message": "If the account exists, check your email for the login link"}
+	user, err := ctrl.userService.GetUserByEmail(input.Email)
+	if err != nil || !user.IsActive {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	linkID := uuid.New().String()
+	token, err := utils.GenerateMagicLinkToken(user.Username, linkID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "JWT",
+			"username":  user.Username,
+		}).Errorf("JWT service could not generate magic link token with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := utils.SetCache(redis.RedisClient, magicLinkKey(linkID), user.Username, utils.MagicLinkLifetime); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "redis",
+		}).Errorf("server could not save magic link with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := sendEmail(user.Email, "Tinder-clone: login link", fmt.Sprintf(
+		"Your link for logging in %s. The link expires in 15 minutes and works once. "+
+			"If it wasn't you, just ignore this email.",
+		serverURL("/auth/magic-link/verify?token="+token),
+	)); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "asynq",
+		}).Errorf("server could not start email delivery with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// @Summary      Login by magic link
+// @Description  Consumes the magic link and issues the same tokens as the password login
+// @Tags         auth
+// @Produce      json
+// @Param        token query string true "Magic link token"
+// @Success      200 {object} MessageResponse
+// @Failure      401 {object} ErrorResponse
+// @Failure      403 {object} ErrorResponse
+// @Failure      500 {object} ErrorResponse
+// @Router       /auth/magic-link/verify [get]
+func (ctrl *AuthController) VerifyMagicLinkController(c *gin.Context) {
+	claims, err := utils.ParseMagicLinkToken(c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login link is invalid or expired"})
+		return
+	}
+	// GetDel makes the link single-use even if it is opened twice at the same time
+	username, err := redis.RedisClient.GetDel(c, magicLinkKey(claims.ID)).Result()
+	if err != nil || username != claims.Username {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"username":  claims.Username,
+			"ip":        c.ClientIP(),
+		}).Info("magic link was used twice or revoked")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login link was already used"})
+		return
+	}
+
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login link is invalid or expired"})
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is not active"})
+		return
+	}
+	ctrl.completeLogin(c, user)
+}
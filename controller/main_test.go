@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	config.ConnectTestDB()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/ilyaDyb/go_rest_api/ws"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxReportEvidence = 20
+	maxReportComment  = 2000
+)
+
+// closeChats closes the chats between the users and tells both of them to drop the chats.
+func closeChats(chatService *service.ChatService, userID uint, otherID uint) error {
+	chats, err := chatService.CloseChat(userID, otherID)
+	if err != nil {
+		return err
+	}
+	for _, chat := range chats {
+		ws.Publish(ws.EventChatClosed, ws.ChatClosedPayload{ChatID: chat.ID}, chat.User1ID, chat.User2ID)
+	}
+	return nil
+}
+
+type BlockInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// @Summary Block user
+// @Tags user
+// @Description Hides the users from each other and closes their chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param BlockInput body BlockInput true "User to block"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /u/block [post]
+func (ctrl *UserController) BlockUserController(c *gin.Context) {
+	var input BlockInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if input.UserID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't block yourself"})
+		return
+	}
+	if _, err := ctrl.userService.GetUserByID(input.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	block := models.Block{BlockerID: user.ID, BlockedID: input.UserID}
+	if err := ctrl.moderationService.CreateBlock(&block); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("user could not block user: %v with err: %v", input.UserID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not block user"})
+		return
+	}
+	if err := closeChats(&ctrl.chatService, user.ID, input.UserID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("could not close chat with blocked user: %v with err: %v", input.UserID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not close chat"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// @Summary Unblock user
+// @Tags user
+// @Description The users can see each other again, the closed chat stays closed
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param user_id path int true "Blocked user ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /u/block/{user_id} [delete]
+func (ctrl *UserController) UnblockUserController(c *gin.Context) {
+	blockedID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid value for user_id"})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err := ctrl.moderationService.DeleteBlock(user.ID, uint(blockedID)); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("user could not unblock user: %v with err: %v", blockedID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not unblock user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+// @Summary Blocked users
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 200 {array} models.Block
+// @Failure 500 {object} ErrorResponse
+// @Router /u/blocks [get]
+func (ctrl *UserController) BlockedUsersController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	blocks, err := ctrl.moderationService.GetBlocks(user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("could not get blocked users with err: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get blocked users"})
+		return
+	}
+	c.JSON(http.StatusOK, blocks)
+}
+
+type ReportInput struct {
+	UserID     uint   `json:"user_id" binding:"required"`
+	Reason     string `json:"reason" binding:"required"`
+	MessageIDs []uint `json:"message_ids"`
+	Comment    string `json:"comment"`
+}
+
+// @Summary Report user
+// @Tags user
+// @Description Sends the user to the moderation queue. Reason is one of spam, harassment, inappropriate_content, fake_profile, underage, other; message_ids are the evidence from the chat with the user
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param ReportInput body ReportInput true "Report"
+// @Success 201 {object} models.Report
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /u/report [post]
+func (ctrl *UserController) ReportUserController(c *gin.Context) {
+	var input ReportInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Comment = strings.TrimSpace(input.Comment)
+	input.MessageIDs = uniqueIDs(input.MessageIDs)
+	if !models.IsValidReportReason(input.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be one of " + strings.Join(models.ReportReasons, ", ")})
+		return
+	}
+	if len(input.MessageIDs) > maxReportEvidence || len(input.Comment) > maxReportComment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many messages or too long comment"})
+		return
+	}
+
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if input.UserID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't report yourself"})
+		return
+	}
+	if _, err := ctrl.userService.GetUserByID(input.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	report := models.Report{
+		ReporterID: user.ID,
+		ReportedID: input.UserID,
+		Reason:     input.Reason,
+		Comment:    input.Comment,
+		Status:     models.ReportStatusOpen,
+	}
+	if len(input.MessageIDs) > 0 {
+		messages, err := ctrl.chatService.GetMessagesByIDs(input.MessageIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load messages"})
+			return
+		}
+		// evidence can only come from the conversation of the two users
+		for _, message := range messages {
+			if !(message.SenderID == user.ID && message.ReceiverID == input.UserID) &&
+				!(message.SenderID == input.UserID && message.ReceiverID == user.ID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "messages must be from your chat with the user"})
+				return
+			}
+		}
+		if len(messages) != len(input.MessageIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "messages not found"})
+			return
+		}
+		report.Messages = messages
+	}
+
+	if err := ctrl.moderationService.CreateReport(&report); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("user could not report user: %v with err: %v", input.UserID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create report"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component":   "user",
+		"report_id":   report.ID,
+		"reported_id": report.ReportedID,
+		"reason":      report.Reason,
+	}).Info("new report in the moderation queue")
+	c.JSON(http.StatusCreated, report)
+}
+
+// uniqueIDs drops repeated ids keeping the order, so the count of loaded messages
+// can be compared with the count of requested ones.
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportWithRepeatedMessageIDs(t *testing.T) {
+	ctrl := newTestUserController()
+	sender, receiver, message := newTestChat(t, "report_dup")
+
+	body := fmt.Sprintf(`{"user_id": %d, "reason": "harassment", "message_ids": [%d, %d, %d]}`,
+		sender.ID, message.ID, message.ID, message.ID)
+	w := serveAs(receiver.Username, http.MethodPost, "/u/report", body, "/u/report", ctrl.ReportUserController)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var report models.Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Messages, 1)
+	assert.Equal(t, message.ID, report.Messages[0].ID)
+
+	// an id that doesn't exist is still reported as missing
+	body = fmt.Sprintf(`{"user_id": %d, "reason": "harassment", "message_ids": [%d, %d]}`,
+		sender.ID, message.ID, message.ID+1000)
+	w = serveAs(receiver.Username, http.MethodPost, "/u/report", body, "/u/report", ctrl.ReportUserController)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "messages not found")
+}
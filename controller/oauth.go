@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/api"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthStateLifetime = 10 * time.Minute
+	// oauthStateCookie binds the state to the browser which started the login,
+	// a callback link opened in another browser is rejected
+	oauthStateCookie = "oauth_state"
+	oauthStateBytes  = 32
+)
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+type oauthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func oauthStateKey(state string) string {
+	return "oauth_state:" + state
+}
+
+// @Summary      Social login
+// @Description  Redirects to the login page of the provider
+// @Tags         auth
+// @Param        provider  path  string  true  "Provider name, e.g. google"
+// @Success      302
+// @Failure      404         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/oauth/{provider} [get]
+func (ctrl *AuthController) OAuthLoginController(c *gin.Context) {
+	provider, ok := api.GetOAuthProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+	verifier, challenge, err := api.NewPKCEVerifier()
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+		}).Errorf("server could not generate pkce verifier with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	state, err := utils.RandomToken(oauthStateBytes)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+		}).Errorf("server could not generate oauth state with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	data, _ := json.Marshal(oauthState{Provider: provider.Name(), CodeVerifier: verifier})
+	if err := utils.SetCache(redis.RedisClient, oauthStateKey(state), string(data), oauthStateLifetime); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+			"service":   "redis",
+		}).Errorf("server could not save oauth state with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	setOAuthStateCookie(c, state, int(oauthStateLifetime.Seconds()))
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, challenge))
+}
+
+// setOAuthStateCookie stores the state for the callback, it is sent only to the
+// oauth routes and the provider's redirect back is a top-level GET, so Lax is enough.
+func setOAuthStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, maxAge, "/auth/oauth", "", config.ServerProtocol == "https://", true)
+}
+
+// @Summary      Social login callback
+// @Description  Creates or links account by verified email and returns token pair
+// @Tags         auth
+// @Produce      json
+// @Param        provider  path   string  true  "Provider name"
+// @Param        code      query  string  true  "Authorization code"
+// @Param        state     query  string  true  "State"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      400         {object}  ErrorResponse
+// @Failure      403         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/oauth/{provider}/callback [get]
+func (ctrl *AuthController) OAuthCallbackController(c *gin.Context) {
+	provider, ok := api.GetOAuthProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider returned error: " + errParam})
+		return
+	}
+	cookieState, err := c.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookieState), []byte(c.Query("state"))) != 1 {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+			"provider":  provider.Name(),
+			"ip":        c.ClientIP(),
+		}).Info("oauth callback with state of another browser")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
+	setOAuthStateCookie(c, "", -1)
+	// state is single-use, GetDel makes sure the callback can't be replayed
+	rawState, err := redis.RedisClient.GetDel(c, oauthStateKey(c.Query("state"))).Result()
+	var state oauthState
+	if err != nil || json.Unmarshal([]byte(rawState), &state) != nil || state.Provider != provider.Name() {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+			"provider":  provider.Name(),
+			"ip":        c.ClientIP(),
+		}).Info("oauth callback with invalid or expired state")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+			"provider":  provider.Name(),
+		}).Errorf("server could not exchange authorization code with error: %v", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not complete login with provider"})
+		return
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "provider account has no verified email"})
+		return
+	}
+
+	user, err := ctrl.userForIdentity(provider.Name(), identity)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "oauth",
+			"service":   "gorm",
+			"provider":  provider.Name(),
+		}).Errorf("server could not find or create user for social identity with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	ctrl.completeLogin(c, user)
+}
+
+// userForIdentity returns the user linked with the identity. Unknown identities
+// are linked to the user with the same email or a new active user is created.
+// An unconfirmed user with the same email loses the password on linking.
+func (ctrl *AuthController) userForIdentity(provider string, identity *api.OAuthIdentity) (*models.User, error) {
+	linked, err := ctrl.userService.GetLinkedIdentity(provider, identity.Subject)
+	if err == nil {
+		return ctrl.userService.GetUserByID(linked.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user, err := ctrl.userService.GetUserByEmail(identity.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user == nil {
+		user, err = ctrl.createSocialUser(identity)
+		if err != nil {
+			return nil, err
+		}
+	} else if !user.IsActive {
+		// whoever registered the email never proved owning it, the provider did. Credentials
+		// and sessions set up before are dropped so they can't be used to take the account over.
+		user.IsActive = true
+		user.ConfirmationHash = ""
+		user.Password = ""
+		user.TwoFactorEnabled = false
+		user.TOTPSecret = ""
+		user.PendingEmail = ""
+		user.EmailChangeHash = ""
+		if err := ctrl.userService.UpdateUser(user); err != nil {
+			return nil, err
+		}
+		if err := ctrl.userService.ReplaceRecoveryCodes(user.ID, nil); err != nil {
+			return nil, err
+		}
+		if err := ctrl.sessionService.DeleteUserSessions(user.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctrl.userService.CreateLinkedIdentity(&models.LinkedIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}); err != nil {
+		return nil, err
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "oauth",
+		"provider":  provider,
+		"username":  user.Username,
+	}).Info("social identity was linked to user")
+	return user, nil
+}
+
+func (ctrl *AuthController) createSocialUser(identity *api.OAuthIdentity) (*models.User, error) {
+	base := usernameUnsafeChars.ReplaceAllString(strings.ToLower(strings.Split(identity.Email, "@")[0]), "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	username := base
+	for i := 0; ; i++ {
+		exists, err := ctrl.userService.UserIsExists(username, identity.Email)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			break
+		}
+		if i >= 5 {
+			return nil, errors.New("could not pick free username")
+		}
+		username = base + "_" + strings.ToLower(utils.RandStringRunes(4))
+	}
+
+	// password stays empty, such account can login only through the provider
+	// until the user sets a password with /auth/drop-password
+	user := models.User{
+		Username:  username,
+		Email:     identity.Email,
+		Firstname: identity.Firstname,
+		Lastname:  identity.Lastname,
+		Role:      models.RoleUser,
+		IsActive:  true,
+	}
+	if err := ctrl.userService.CreateUser(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/api"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockOAuthProvider struct {
+	identity api.OAuthIdentity
+}
+
+func (p *mockOAuthProvider) Name() string { return "mock" }
+
+func (p *mockOAuthProvider) AuthCodeURL(state string, codeChallenge string) string {
+	return "https://mock.local/auth?state=" + state
+}
+
+func (p *mockOAuthProvider) Exchange(ctx context.Context, code string, codeVerifier string) (*api.OAuthIdentity, error) {
+	identity := p.identity
+	return &identity, nil
+}
+
+// memorySessionRepo keeps sessions in memory instead of redis.
+type memorySessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]models.Session
+}
+
+func newMemorySessionRepo() *memorySessionRepo {
+	return &memorySessionRepo{sessions: map[string]models.Session{}}
+}
+
+func (repo *memorySessionRepo) CreateSession(session *models.Session, ttl time.Duration) error {
+	return repo.UpdateSession(session, ttl)
+}
+
+func (repo *memorySessionRepo) UpdateSession(session *models.Session, ttl time.Duration) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.sessions[session.ID] = *session
+	return nil
+}
+
+func (repo *memorySessionRepo) RotateSession(session *models.Session, refreshID string, ttl time.Duration) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, ok := repo.sessions[session.ID]
+	if !ok {
+		return repository.ErrSessionNotFound
+	}
+	if stored.RefreshID != refreshID {
+		return repository.ErrRefreshTokenReused
+	}
+	stored.RefreshID = session.RefreshID
+	stored.IP = session.IP
+	stored.LastUsedAt = session.LastUsedAt
+	repo.sessions[session.ID] = stored
+	return nil
+}
+
+func (repo *memorySessionRepo) GetSession(sessionID string) (*models.Session, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	session, ok := repo.sessions[sessionID]
+	if !ok {
+		return nil, repository.ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (repo *memorySessionRepo) GetUserSessions(username string) ([]models.Session, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var sessions []models.Session
+	for _, session := range repo.sessions {
+		if session.Username == username {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (repo *memorySessionRepo) DeleteSession(session *models.Session) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.sessions, session.ID)
+	return nil
+}
+
+func (repo *memorySessionRepo) DeleteUserSessions(username string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for id, session := range repo.sessions {
+		if session.Username == username {
+			delete(repo.sessions, id)
+		}
+	}
+	return nil
+}
+
+func newTestAuthController(sessions repository.SessionRepo) *AuthController {
+	return NewAuthController(
+		service.NewUserService(repository.NewPostgresUserRepo(config.DB)),
+		service.NewSessionService(sessions),
+	)
+}
+
+func loginWithMockProvider(t *testing.T, ctrl *AuthController, provider *mockOAuthProvider) *models.User {
+	t.Helper()
+	identity, err := provider.Exchange(context.Background(), "code", "verifier")
+	require.NoError(t, err)
+	user, err := ctrl.userForIdentity(provider.Name(), identity)
+	require.NoError(t, err)
+	return user
+}
+
+func TestOAuthDropsCredentialsOfUnconfirmedAccount(t *testing.T) {
+	sessions := newMemorySessionRepo()
+	ctrl := newTestAuthController(sessions)
+
+	// somebody registers the victim's email with own password and never confirms it
+	squatter := models.User{
+		Username:         "oauth_squatter",
+		Email:            "victim@example.com",
+		Role:             models.RoleUser,
+		IsActive:         false,
+		ConfirmationHash: "pending",
+	}
+	require.NoError(t, squatter.HashPassword("attacker-password"))
+	require.NoError(t, config.DB.Create(&squatter).Error)
+	require.NoError(t, sessions.CreateSession(&models.Session{ID: "squatter-session", Username: squatter.Username}, time.Hour))
+
+	provider := &mockOAuthProvider{identity: api.OAuthIdentity{
+		Subject:       "victim-subject",
+		Email:         "victim@example.com",
+		EmailVerified: true,
+	}}
+	user := loginWithMockProvider(t, ctrl, provider)
+
+	assert.Equal(t, squatter.ID, user.ID)
+	stored, err := ctrl.userService.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.IsActive)
+	assert.Empty(t, stored.ConfirmationHash)
+	assert.Empty(t, stored.Password)
+	assert.Error(t, stored.CheckPassword("attacker-password"))
+
+	remaining, err := sessions.GetUserSessions(squatter.Username)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+
+	linked, err := ctrl.userService.GetLinkedIdentity(provider.Name(), "victim-subject")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, linked.UserID)
+}
+
+func TestOAuthKeepsPasswordOfConfirmedAccount(t *testing.T) {
+	sessions := newMemorySessionRepo()
+	ctrl := newTestAuthController(sessions)
+
+	owner := models.User{
+		Username: "oauth_owner",
+		Email:    "owner@example.com",
+		Role:     models.RoleUser,
+		IsActive: true,
+	}
+	require.NoError(t, owner.HashPassword("owner-password"))
+	require.NoError(t, config.DB.Create(&owner).Error)
+	require.NoError(t, sessions.CreateSession(&models.Session{ID: "owner-session", Username: owner.Username}, time.Hour))
+
+	user := loginWithMockProvider(t, ctrl, &mockOAuthProvider{identity: api.OAuthIdentity{
+		Subject:       "owner-subject",
+		Email:         "owner@example.com",
+		EmailVerified: true,
+	}})
+
+	assert.Equal(t, owner.ID, user.ID)
+	stored, err := ctrl.userService.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.NoError(t, stored.CheckPassword("owner-password"))
+	remaining, err := sessions.GetUserSessions(owner.Username)
+	require.NoError(t, err)
+	assert.Len(t, remaining, 1)
+}
+
+func TestOAuthCreatesUserForUnknownEmail(t *testing.T) {
+	ctrl := newTestAuthController(newMemorySessionRepo())
+
+	user := loginWithMockProvider(t, ctrl, &mockOAuthProvider{identity: api.OAuthIdentity{
+		Subject:       "new-subject",
+		Email:         "newcomer@example.com",
+		EmailVerified: true,
+		Firstname:     "New",
+	}})
+
+	assert.Equal(t, "newcomer", user.Username)
+	assert.True(t, user.IsActive)
+	assert.Empty(t, user.Password)
+
+	again := loginWithMockProvider(t, ctrl, &mockOAuthProvider{identity: api.OAuthIdentity{
+		Subject:       "new-subject",
+		Email:         "newcomer@example.com",
+		EmailVerified: true,
+	}})
+	assert.Equal(t, user.ID, again.ID)
+}
+
+func TestOAuthCallbackNeedsStateCookie(t *testing.T) {
+	api.RegisterOAuthProvider(&mockOAuthProvider{})
+	ctrl := newTestAuthController(newMemorySessionRepo())
+	router := gin.New()
+	router.GET("/auth/oauth/:provider/callback", ctrl.OAuthCallbackController)
+	callback := func(cookie string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth/oauth/mock/callback?code=c&state=started_here", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: cookie})
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// the link was opened in a browser which didn't start the login
+	assert.Equal(t, http.StatusBadRequest, callback("").Code)
+	assert.Equal(t, http.StatusBadRequest, callback("started_elsewhere").Code)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/api"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/sirupsen/logrus"
+)
+
+const maxWebhookSize = 1 << 20
+
+type PaymentController struct {
+	subscriptionService service.SubscriptionService
+}
+
+func NewPaymentController(subscriptionService service.SubscriptionService) *PaymentController {
+	return &PaymentController{subscriptionService: subscriptionService}
+}
+
+// WebhookController godoc
+// @Summary Payment webhook
+// @Description Subscription events of the payment provider, the body is verified by the provider's signature. Events are applied once, retries of applied events are acknowledged
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param provider path string true "Payment provider, e.g. fake"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/webhook/{provider} [post]
+func (ctrl *PaymentController) WebhookController(c *gin.Context) {
+	provider, ok := api.GetPaymentProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown payment provider"})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read body"})
+		return
+	}
+	event, err := provider.ParseWebhook(c.Request.Header, body)
+	if errors.Is(err, api.ErrInvalidSignature) {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "payments",
+			"provider":  provider.Name(),
+		}).Warn("webhook with invalid signature")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = ctrl.subscriptionService.ApplyPaymentEvent(provider.Name(), event)
+	if errors.Is(err, repository.ErrPaymentEventProcessed) {
+		c.JSON(http.StatusOK, gin.H{"message": "Event was already processed"})
+		return
+	}
+	if errors.Is(err, service.ErrUnknownPlan) || errors.Is(err, service.ErrInvalidPaymentEvent) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "payments",
+			"provider":  provider.Name(),
+			"event_id":  event.ID,
+		}).Errorf("server could not apply payment event with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not apply event"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component":       "payments",
+		"provider":        provider.Name(),
+		"event_id":        event.ID,
+		"type":            event.Type,
+		"user_id":         event.UserID,
+		"subscription_id": event.SubscriptionID,
+	}).Info("payment event applied")
+	c.JSON(http.StatusOK, gin.H{"message": "Event applied"})
+}
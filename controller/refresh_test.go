@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadTestSigningKey makes utils sign tokens with a fresh Ed25519 key.
+func loadTestSigningKey(t *testing.T) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_ACTIVE_KID", "")
+	require.NoError(t, utils.LoadSigningKeys())
+}
+
+func TestRefreshRotatesTokenOnce(t *testing.T) {
+	loadTestSigningKey(t)
+	sessions := newMemorySessionRepo()
+	ctrl := newTestAuthController(sessions)
+	user := createTestUser(t, "refresh_user")
+	session := models.Session{ID: "refresh-session", Username: user.Username, RefreshID: "refresh-1", CreatedAt: time.Now()}
+	require.NoError(t, sessions.CreateSession(&session, time.Hour))
+	refreshToken, err := utils.GenerateRefreshToken(user.Username, session.ID, session.RefreshID)
+	require.NoError(t, err)
+	body, err := json.Marshal(InputRefresh{RefreshToken: refreshToken})
+	require.NoError(t, err)
+
+	const attempts = 8
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serveAs("", http.MethodPost, "/auth/refresh", string(body), "/auth/refresh", ctrl.RefreshController).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, 1, counts[http.StatusOK])
+	assert.Equal(t, attempts-1, counts[http.StatusUnauthorized])
+
+	// the reuse revoked the session, the rotated token doesn't work either
+	_, err = sessions.GetSession(session.ID)
+	assert.ErrorIs(t, err, repository.ErrSessionNotFound)
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/sirupsen/logrus"
+)
+
+// planOf is the plan whose limits apply to the user, the free plan is used
+// when the subscription can't be loaded.
+func (ctrl *UserController) planOf(user *models.User) string {
+	plan, err := ctrl.subscriptionService.PlanOf(user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+			"user_id":   user.ID,
+		}).Errorf("server could not load subscription with error: %v", err.Error())
+	}
+	return plan
+}
+
+// requireEntitlement writes 403 when the plan of the user doesn't include the entitlement.
+func (ctrl *UserController) requireEntitlement(c *gin.Context, user *models.User, entitlement string) bool {
+	if config.LimitsOf(ctrl.planOf(user)).Has(entitlement) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "this feature needs a subscription", "entitlement": entitlement})
+	return false
+}
+
+// useQuota counts the action and writes the response when the action
+// is not allowed, the returned error means the request is handled.
+func (ctrl *UserController) useQuota(c *gin.Context, user *models.User, action string) (*service.Quota, error) {
+	quota, err := ctrl.quotaService.Use(user, ctrl.planOf(user), action)
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily limit of " + action + " reached", "quota": quota})
+		return nil, err
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "redis",
+			"user_id":   user.ID,
+		}).Errorf("server could not count %v with error: %v", action, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not check the daily limit"})
+		return nil, err
+	}
+	return quota, nil
+}
+
+// refundQuota gives the action back when it failed after it was counted.
+func (ctrl *UserController) refundQuota(user *models.User, action string) {
+	if action == "" {
+		return
+	}
+	if err := ctrl.quotaService.Refund(user, action); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "redis",
+			"user_id":   user.ID,
+		}).Errorf("server could not refund %v with error: %v", action, err.Error())
+	}
+}
+
+// @Summary Rewind
+// @Tags user
+// @Description Undoes the last dislike if it was made within the rewind window of the plan and returns the profile back to the feed. Needs the rewind entitlement, rewinds are limited per day by the plan
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /u/rewind [post]
+func (ctrl *UserController) RewindController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if !ctrl.requireEntitlement(c, user, models.EntitlementRewind) {
+		return
+	}
+	interaction, err := ctrl.userService.GetLastUserInteraction(user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "nothing to rewind"})
+		return
+	}
+	// only the very last swipe can be rewound, likes may already have made a match
+	if interaction.InteractionType != models.InteractionDislike {
+		c.JSON(http.StatusConflict, gin.H{"error": "only a dislike can be rewound"})
+		return
+	}
+	if time.Since(interaction.CreatedAt) > config.LimitsOf(ctrl.planOf(user)).RewindWindow {
+		c.JSON(http.StatusConflict, gin.H{"error": "the dislike is too old to rewind"})
+		return
+	}
+	quota, err := ctrl.useQuota(c, user, service.QuotaRewinds)
+	if err != nil {
+		return
+	}
+	if err := ctrl.userService.DeleteUserInteraction(interaction); err != nil {
+		ctrl.refundQuota(user, service.QuotaRewinds)
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+			"user_id":   user.ID,
+			"target_id": interaction.TargetID,
+		}).Errorf("server could not rewind interaction with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not rewind"})
+		return
+	}
+	target, err := ctrl.userService.GetUserByID(interaction.TargetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": target, "quota": quota})
+}
+
+// @Summary Daily limits
+// @Tags user
+// @Description Usage of likes, superlikes, rewinds and boosts today, limit and remaining are -1 when unlimited
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 200 {array} service.Quota
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /u/quotas [get]
+func (ctrl *UserController) QuotasController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	quotas, err := ctrl.quotaService.Quotas(user, ctrl.planOf(user))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "redis",
+			"username":  username,
+		}).Errorf("server could not get quotas with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not get daily limits"})
+		return
+	}
+	c.JSON(http.StatusOK, quotas)
+}
+
+// @Summary Boost
+// @Tags user
+// @Description Puts the user at the top of other users' feeds for 30 minutes. Needs the boost entitlement, boosts are limited per day by the plan
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /u/boost [post]
+func (ctrl *UserController) BoostController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if !ctrl.requireEntitlement(c, user, models.EntitlementBoost) {
+		return
+	}
+	if user.BoostedUntil != nil && user.BoostedUntil.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "the profile is already boosted"})
+		return
+	}
+	quota, err := ctrl.useQuota(c, user, service.QuotaBoosts)
+	if err != nil {
+		return
+	}
+	boostedUntil := time.Now().Add(config.BoostDuration)
+	if err := ctrl.userService.SetBoostedUntil(user.ID, boostedUntil); err != nil {
+		ctrl.refundQuota(user, service.QuotaBoosts)
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("server could not boost user with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not boost the profile"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"boosted_until": boostedUntil, "quota": quota})
+}
+
+type SubscriptionResponse struct {
+	Plan         string               `json:"plan"`
+	Entitlements []string             `json:"entitlements"`
+	Subscription *models.Subscription `json:"subscription,omitempty"`
+}
+
+// @Summary Subscription
+// @Tags user
+// @Description Current plan with its entitlements, subscription is empty on the free plan
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 200 {object} SubscriptionResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /u/subscription [get]
+func (ctrl *UserController) SubscriptionController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	subscription, err := ctrl.subscriptionService.GetActiveSubscription(user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("server could not load subscription with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not load subscription"})
+		return
+	}
+	response := SubscriptionResponse{Plan: config.PlanFree, Subscription: subscription}
+	if subscription != nil {
+		response.Plan = subscription.Plan
+	}
+	response.Entitlements = config.LimitsOf(response.Plan).Entitlements
+	if response.Entitlements == nil {
+		response.Entitlements = []string{}
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryQuotaRepo keeps quota counters in memory instead of redis.
+type memoryQuotaRepo struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func (repo *memoryQuotaRepo) Incr(key string, expireAt time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.counters[key]++
+	return repo.counters[key], nil
+}
+
+func (repo *memoryQuotaRepo) Decr(key string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.counters[key]--
+	return nil
+}
+
+func (repo *memoryQuotaRepo) Get(key string) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return repo.counters[key], nil
+}
+
+func newTestUserController() *UserController {
+	db := config.DB
+	return NewUserController(
+		service.NewUserService(repository.NewPostgresUserRepo(db)),
+		service.NewChatService(repository.NewPostgresChatRepo(db)),
+		service.NewSessionService(newMemorySessionRepo()),
+		service.NewModerationService(repository.NewPostgresModerationRepo(db)),
+		service.NewQuotaService(&memoryQuotaRepo{counters: map[string]int64{}}),
+		service.NewSubscriptionService(repository.NewPostgresSubscriptionRepo(db)),
+	)
+}
+
+// subscribe gives the user the plan, the free plan needs no subscription.
+func subscribe(t *testing.T, ctrl *UserController, user models.User, plan string) {
+	t.Helper()
+	if plan == config.PlanFree {
+		return
+	}
+	_, err := ctrl.subscriptionService.Grant(user.ID, plan, time.Hour, user.ID)
+	require.NoError(t, err)
+}
+
+func TestRewindNeedsEntitlement(t *testing.T) {
+	ctrl := newTestUserController()
+	tests := []struct {
+		plan string
+		want int
+	}{
+		{config.PlanFree, http.StatusForbidden},
+		{config.PlanPlus, http.StatusOK},
+		{config.PlanPremium, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plan, func(t *testing.T) {
+			user := createTestUser(t, "rewind_"+tt.plan)
+			target := createTestUser(t, "rewind_target_"+tt.plan)
+			subscribe(t, ctrl, user, tt.plan)
+			interaction := models.UserInteraction{UserID: user.ID, TargetID: target.ID, InteractionType: models.InteractionDislike}
+			require.NoError(t, config.DB.Create(&interaction).Error)
+
+			w := serveAs(user.Username, http.MethodPost, "/u/rewind", "", "/u/rewind", ctrl.RewindController)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+
+			var count int64
+			require.NoError(t, config.DB.Model(&models.UserInteraction{}).Where("id = ?", interaction.ID).Count(&count).Error)
+			if tt.want == http.StatusOK {
+				assert.Zero(t, count)
+			} else {
+				assert.Equal(t, int64(1), count)
+				assert.Contains(t, w.Body.String(), models.EntitlementRewind)
+			}
+		})
+	}
+}
+
+func TestBoostNeedsEntitlement(t *testing.T) {
+	ctrl := newTestUserController()
+	tests := []struct {
+		plan string
+		want int
+	}{
+		{config.PlanFree, http.StatusForbidden},
+		{config.PlanPlus, http.StatusForbidden},
+		{config.PlanPremium, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plan, func(t *testing.T) {
+			user := createTestUser(t, "boost_"+tt.plan)
+			subscribe(t, ctrl, user, tt.plan)
+
+			w := serveAs(user.Username, http.MethodPost, "/u/boost", "", "/u/boost", ctrl.BoostController)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+
+			stored, err := ctrl.userService.GetUserByID(user.ID)
+			require.NoError(t, err)
+			if tt.want == http.StatusOK {
+				require.NotNil(t, stored.BoostedUntil)
+				assert.True(t, stored.BoostedUntil.After(time.Now()))
+			} else {
+				assert.Nil(t, stored.BoostedUntil)
+			}
+		})
+	}
+
+	// premium has one boost a day
+	user := createTestUser(t, "boost_twice")
+	subscribe(t, ctrl, user, config.PlanPremium)
+	require.Equal(t, http.StatusOK, serveAs(user.Username, http.MethodPost, "/u/boost", "", "/u/boost", ctrl.BoostController).Code)
+	require.NoError(t, ctrl.userService.SetBoostedUntil(user.ID, time.Now().Add(-time.Minute)))
+	assert.Equal(t, http.StatusTooManyRequests, serveAs(user.Username, http.MethodPost, "/u/boost", "", "/u/boost", ctrl.BoostController).Code)
+}
+
+func TestLikedByUsersNeedsEntitlement(t *testing.T) {
+	ctrl := newTestUserController()
+	tests := []struct {
+		plan string
+		want int
+	}{
+		{config.PlanFree, http.StatusForbidden},
+		{config.PlanPlus, http.StatusForbidden},
+		{config.PlanPremium, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plan, func(t *testing.T) {
+			user := models.User{Username: "liked_" + tt.plan, Email: "liked_" + tt.plan + "@example.com", IsActive: true, Sex: "male", Age: 30}
+			liker := models.User{Username: "liker_" + tt.plan, Email: "liker_" + tt.plan + "@example.com", IsActive: true, Sex: "female", Age: 30}
+			require.NoError(t, config.DB.Create(&user).Error)
+			require.NoError(t, config.DB.Create(&liker).Error)
+			subscribe(t, ctrl, user, tt.plan)
+			require.NoError(t, config.DB.Create(&models.UserInteraction{UserID: liker.ID, TargetID: user.ID, InteractionType: models.InteractionLike}).Error)
+
+			w := serveAs(user.Username, http.MethodGet, "/u/liked-by-users", "", "/u/liked-by-users", ctrl.LikedByUsersController)
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+
+			if tt.want == http.StatusOK {
+				var likers []models.User
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &likers))
+				require.Len(t, likers, 1)
+				assert.Equal(t, liker.ID, likers[0].ID)
+				return
+			}
+			var body struct {
+				Entitlement string `json:"entitlement"`
+				Count       int    `json:"count"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, models.EntitlementSeeLikes, body.Entitlement)
+			assert.Equal(t, 1, body.Count)
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	requireAdminTwoFactorKey = "settings:require_admin_2fa"
+	recoveryCodesCount       = 10
+)
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorEnrollInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+func adminTwoFactorRequired() bool {
+	value, err := utils.GetCache(redis.RedisClient, requireAdminTwoFactorKey)
+	return err == nil && value == "1"
+}
+
+// completeLogin is called once the first factor was checked. It either starts
+// a session or asks the client to pass the second step with a challenge token.
+func (ctrl *AuthController) completeLogin(c *gin.Context, user *models.User) {
+	if user.TwoFactorEnabled {
+		challenge, err := utils.GenerateChallengeToken(user.Username, utils.PurposeTwoFactorLogin)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "auth",
+				"service":   "JWT",
+				"username":  user.Username,
+			}).Errorf("JWT service could not generate challenge token with error: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge_token": challenge})
+		return
+	}
+	if user.Role == models.RoleAdmin && adminTwoFactorRequired() {
+		challenge, err := utils.GenerateChallengeToken(user.Username, utils.PurposeTwoFactorEnroll)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "auth",
+				"service":   "JWT",
+				"username":  user.Username,
+			}).Errorf("JWT service could not generate challenge token with error: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":               "two-factor authentication is required for admin accounts",
+			"enrollment_required": true,
+			"challenge_token":     challenge,
+		})
+		return
+	}
+	ctrl.startSession(c, user)
+}
+
+// enrollTwoFactor stores a new pending secret and recovery codes, 2FA becomes
+// enabled only after the first valid code.
+func (ctrl *AuthController) enrollTwoFactor(c *gin.Context, user *models.User) {
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"username":  user.Username,
+		}).Errorf("server could not generate totp secret with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	recoveryCodes, err := utils.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"username":  user.Username,
+		}).Errorf("server could not generate recovery codes with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, utils.GetSHA256Hash(code))
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  user.Username,
+		}).Errorf("databse service could not save totp secret with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := ctrl.userService.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  user.Username,
+		}).Errorf("databse service could not save recovery codes with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(config.TOTPIssuer, user.Username, secret),
+		"recovery_codes":   recoveryCodes,
+	})
+}
+
+// checkTOTP validates the code and remembers its time step so it can't be replayed.
+func checkTOTP(userService *service.UserService, user *models.User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false, nil
+	}
+	user.TOTPLastStep = step
+	return true, userService.UpdateUser(user)
+}
+
+// checkSecondFactor accepts either a TOTP code or one of the unused recovery codes.
+func checkSecondFactor(userService *service.UserService, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	ok, err := checkTOTP(userService, user, code)
+	if err != nil || ok {
+		return ok, err
+	}
+	return userService.UseRecoveryCode(user.ID, utils.GetSHA256Hash(strings.ToLower(code)))
+}
+
+// @Summary      Start 2FA enrolment
+// @Description  Generates TOTP secret and recovery codes, 2FA must be activated with the first code
+// @Tags         auth
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      409         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/2fa/enroll [post]
+func (ctrl *AuthController) EnrollTwoFactorController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	ctrl.enrollTwoFactor(c, user)
+}
+
+// @Summary      Activate 2FA
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Param        TwoFactorCodeInput  body      TwoFactorCodeInput  true  "Code from authenticator app"
+// @Success      200         {object}  MessageResponse
+// @Failure      400         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/2fa/activate [post]
+func (ctrl *AuthController) ActivateTwoFactorController(c *gin.Context) {
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	ok, err := checkTOTP(&ctrl.userService, user, input.Code)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("databse service could not update user with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+	user.TwoFactorEnabled = true
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("databse service could not enable 2fa with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"component": "auth",
+		"username":  username,
+	}).Info("user enabled two-factor authentication")
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled"})
+}
+
+// @Summary      Disable 2FA
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "With the Bearer started"
+// @Param        TwoFactorCodeInput  body      TwoFactorCodeInput  true  "TOTP or recovery code"
+// @Success      200         {object}  MessageResponse
+// @Failure      400         {object}  ErrorResponse
+// @Failure      403         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/2fa/disable [post]
+func (ctrl *AuthController) DisableTwoFactorController(c *gin.Context) {
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if user.Role == models.RoleAdmin && adminTwoFactorRequired() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for admin accounts"})
+		return
+	}
+	ok, err := checkSecondFactor(&ctrl.userService, user, input.Code)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("databse service could not check second factor with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+	user.TwoFactorEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("databse service could not disable 2fa with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := ctrl.userService.ReplaceRecoveryCodes(user.ID, nil); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  username,
+		}).Errorf("databse service could not delete recovery codes with error: %v", err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// @Summary      2FA enrolment during login
+// @Description  Used by accounts which must enable 2FA before they can login
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        TwoFactorEnrollInput  body      TwoFactorEnrollInput  true  "Challenge token from /auth/login"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      401         {object}  ErrorResponse
+// @Router       /auth/login/2fa/enroll [post]
+func (ctrl *AuthController) LoginEnrollTwoFactorController(c *gin.Context) {
+	var input TwoFactorEnrollInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	claims, err := utils.ParseChallengeToken(input.ChallengeToken)
+	if err != nil || claims.Purpose != utils.PurposeTwoFactorEnroll {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid challenge token"})
+		return
+	}
+	user, err := ctrl.userService.GetUserByUsername(claims.Username)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid challenge token"})
+		return
+	}
+	ctrl.enrollTwoFactor(c, user)
+}
+
+// @Summary      Second login step
+// @Description  Exchanges challenge token and TOTP (or recovery) code for a token pair
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        TwoFactorLoginInput  body      TwoFactorLoginInput  true  "Challenge token and code"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      400         {object}  ErrorResponse
+// @Failure      401         {object}  ErrorResponse
+// @Failure      500         {object}  ErrorResponse
+// @Router       /auth/login/2fa [post]
+func (ctrl *AuthController) LoginTwoFactorController(c *gin.Context) {
+	var input TwoFactorLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	claims, err := utils.ParseChallengeToken(input.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid challenge token"})
+		return
+	}
+	if rejectIfLocked(c, loginIPKey(c.ClientIP()), loginAccountKey(claims.Username)) {
+		return
+	}
+	user, err := ctrl.userService.GetUserByUsername(claims.Username)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid challenge token"})
+		return
+	}
+
+	var ok bool
+	switch claims.Purpose {
+	case utils.PurposeTwoFactorLogin:
+		ok, err = checkSecondFactor(&ctrl.userService, user, input.Code)
+	case utils.PurposeTwoFactorEnroll:
+		// first code after forced enrolment also activates 2FA
+		ok, err = checkTOTP(&ctrl.userService, user, input.Code)
+		if err == nil && ok {
+			user.TwoFactorEnabled = true
+			err = ctrl.userService.UpdateUser(user)
+		}
+	default:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid challenge token"})
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"service":   "gorm",
+			"username":  user.Username,
+		}).Errorf("databse service could not check second factor with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "auth",
+			"username":  user.Username,
+			"ip":        c.ClientIP(),
+		}).Info("user entered invalid second factor code")
+		registerFailedLogin(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	ctrl.startSession(c, user)
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// totpCodeAt computes the code like an authenticator app does (RFC 6238, SHA-1, 6 digits, 30 s).
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	require.NoError(t, err)
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func newTwoFactorUser(t *testing.T, username string) models.User {
+	t.Helper()
+	secret, err := utils.GenerateTOTPSecret()
+	require.NoError(t, err)
+	user := createTestUser(t, username)
+	user.TwoFactorEnabled = true
+	user.TOTPSecret = secret
+	require.NoError(t, config.DB.Save(&user).Error)
+	return user
+}
+
+func TestCheckTOTPRejectsReplay(t *testing.T) {
+	ctrl := newTestUserController()
+	user := newTwoFactorUser(t, "totp_replay")
+	now := time.Now()
+	code := totpCodeAt(t, user.TOTPSecret, now)
+
+	ok, err := checkTOTP(&ctrl.userService, &user, code)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// the accepted step is stored, the same code is rejected even by a fresh load
+	stored, err := ctrl.userService.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Unix()/30, stored.TOTPLastStep)
+	ok, err = checkTOTP(&ctrl.userService, stored, code)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// the code of the previous step is still within the skew but older than the accepted one
+	ok, err = checkTOTP(&ctrl.userService, stored, totpCodeAt(t, user.TOTPSecret, now.Add(-30*time.Second)))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRecoveryCodesAreOneTime(t *testing.T) {
+	ctrl := newTestUserController()
+	user := newTwoFactorUser(t, "totp_recovery")
+	codes, err := utils.GenerateRecoveryCodes(2)
+	require.NoError(t, err)
+	for _, code := range codes {
+		recovery := models.RecoveryCode{UserID: user.ID, CodeHash: utils.GetSHA256Hash(code)}
+		require.NoError(t, config.DB.Create(&recovery).Error)
+	}
+
+	// codes are accepted with spaces and in upper case as users type them
+	ok, err := checkSecondFactor(&ctrl.userService, &user, " "+codes[0]+" ")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = checkSecondFactor(&ctrl.userService, &user, codes[0])
+	require.NoError(t, err)
+	assert.False(t, ok, "a used recovery code must be rejected")
+
+	other := createTestUser(t, "totp_recovery_other")
+	ok, err = checkSecondFactor(&ctrl.userService, &other, codes[1])
+	require.NoError(t, err)
+	assert.False(t, ok, "recovery codes belong to their user")
+
+	ok, err = checkSecondFactor(&ctrl.userService, &user, strings.ToUpper(codes[1]))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
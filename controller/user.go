@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,21 +16,33 @@ import (
 	"github.com/ilyaDyb/go_rest_api/config"
 	"github.com/ilyaDyb/go_rest_api/logger"
 	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/ranking"
 	"github.com/ilyaDyb/go_rest_api/service"
 	"github.com/ilyaDyb/go_rest_api/utils"
+	"github.com/ilyaDyb/go_rest_api/ws"
 	"github.com/rosberry/go-pagination"
 	"github.com/sirupsen/logrus"
 )
 
 type UserController struct {
-	userService service.UserService
-	chatService service.ChatService
+	userService         service.UserService
+	chatService         service.ChatService
+	sessionService      service.SessionService
+	moderationService   service.ModerationService
+	quotaService        service.QuotaService
+	subscriptionService service.SubscriptionService
+	ranker              ranking.Ranker
 }
 
-func NewUserController(userService service.UserService, chatService service.ChatService) *UserController {
+func NewUserController(userService service.UserService, chatService service.ChatService, sessionService service.SessionService, moderationService service.ModerationService, quotaService service.QuotaService, subscriptionService service.SubscriptionService) *UserController {
 	return &UserController{
-		userService: userService,
-		chatService: chatService,
+		userService:         userService,
+		chatService:         chatService,
+		sessionService:      sessionService,
+		moderationService:   moderationService,
+		quotaService:        quotaService,
+		subscriptionService: subscriptionService,
+		ranker:              ranking.NewDefaultRanker(),
 	}
 }
 
@@ -59,10 +73,16 @@ func (ctrl *UserController) ProfileController(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
+	isOwner := user.Username == c.MustGet("username").(string)
+	if user.IsDeactivated && !isOwner {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"user":         user,
 		"count_photos": len(user.Photo),
+		"presence":     ws.PresenceOf(user.ID, user.HidePresence && !isOwner),
 	})
 }
 
@@ -80,11 +100,13 @@ func (ctrl *UserController) ProfileController(c *gin.Context) {
 // @Param city formData string false "City"
 // @Param bio formData string false "Bio"
 // @Param hobbies formData string false "Hobbies"
+// @Param timezone formData string false "IANA timezone, e.g. Europe/Berlin, daily limits reset at midnight in it. It can be changed once a week"
 // @Param photo formData file false "Profile Photo"
 // @Success 200 {object} utils.MessageResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 403 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} map[string]interface{}
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /u/profile [put]
 func (ctrl *UserController) EditProfileController(c *gin.Context) {
@@ -96,6 +118,7 @@ func (ctrl *UserController) EditProfileController(c *gin.Context) {
 		City      string                `form:"city" validate:"max=30"`
 		Bio       string                `form:"bio" validate:"max=500"`
 		Hobbies   string                `form:"hobbies" validate:"max=100"`
+		Timezone  string                `form:"timezone" validate:"max=64"`
 		Photo     *multipart.FileHeader `form:"photo"`
 	}
 	currentUsername := c.MustGet("username").(string)
@@ -110,6 +133,12 @@ func (ctrl *UserController) EditProfileController(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Timezone != "" {
+		if _, err := time.LoadLocation(input.Timezone); err != nil || input.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown timezone"})
+			return
+		}
+	}
 
 	user, err := ctrl.userService.GetUserByUsername(currentUsername)
 	if err != nil {
@@ -141,6 +170,18 @@ func (ctrl *UserController) EditProfileController(c *gin.Context) {
 	if input.Hobbies != "" {
 		user.Hobbies = input.Hobbies
 	}
+	if input.Timezone != "" && input.Timezone != user.Timezone {
+		if user.TimezoneChangedAt != nil && time.Since(*user.TimezoneChangedAt) < config.TimezoneChangeInterval {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":    "timezone can be changed once a week",
+				"retry_at": user.TimezoneChangedAt.Add(config.TimezoneChangeInterval),
+			})
+			return
+		}
+		now := time.Now()
+		user.Timezone = input.Timezone
+		user.TimezoneChangedAt = &now
+	}
 	file, err := c.FormFile("photo")
 	if err == nil {
 		if _, err := os.Stat(config.UserPhotoPath); os.IsNotExist(err) {
@@ -302,10 +343,12 @@ func (ctrl *UserController) SetCoordinatesController(c *gin.Context) {
 
 // @Summary      Url for getting users which liked me
 // @Tags user
+// @Description  Needs the see_likes entitlement, without it only the count is returned with 403
 // @Accept       json
 // @Produce      json
 // @Param Authorization header string true "With the Bearer started"
 // @Success      200         {object}  utils.MessageResponse
+// @Failure      403         {object}  map[string]interface{}
 // @Failure      500         {object}  utils.ErrorResponse
 // @Router       /u/liked-by-users [get]
 func (ctrl *UserController) LikedByUsersController(c *gin.Context) {
@@ -328,6 +371,14 @@ func (ctrl *UserController) LikedByUsersController(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	if !config.LimitsOf(ctrl.planOf(user)).Has(models.EntitlementSeeLikes) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":       "seeing who liked you needs a subscription",
+			"entitlement": models.EntitlementSeeLikes,
+			"count":       len(usersWhichLikedMe),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, usersWhichLikedMe)
 }
 
@@ -366,9 +417,13 @@ func (ctrl *UserController) LikedByUsersController(c *gin.Context) {
 
 // @Summary Get profile
 // @Tags user
+// @Description Profiles ranked by distance, common hobbies, age, activity, completeness and superlikes to the user, the whole pool is ranked before paging
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "With the Bearer started"
+// @Param page query int false "Page, starts from 1"
+// @Param limit query int false "Page size, 10 by default"
+// @Success 200 {object} utils.UsersListResponse
 // @Router /u/get-profiles [get]
 func (ctrl *UserController) GetProfilesController(c *gin.Context) {
 	username := c.MustGet("username").(string)
@@ -381,41 +436,38 @@ func (ctrl *UserController) GetProfilesController(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
-	if user.RestrictionEnd.After(time.Now()) && !(user.RestrictionEnd.IsZero()) {
-		logger.Log.WithFields(logrus.Fields{
-			"component": "user",
-		}).Infof("user with username: %v, have restriction for liking other users which expire at %02d-%02d-%04d", username, user.RestrictionEnd.Month(), user.RestrictionEnd.Day(), user.RestrictionEnd.Month())
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("you have restriction for interaction expire at %02d-%02d", user.RestrictionEnd.Month(), user.RestrictionEnd.Day())})
-		return
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 10
 	}
-	userID := user.ID
-	// if user have subscription then set limit = 100 for example
-	paginator, err := pagination.New(pagination.Options{
-		GinContext: c,
-		DB:         config.DB,
-		Model:      &models.User{},
-		Limit:      10,
-	})
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"component": "user",
-		}).Errorf("server could not send response to user: %v, due to error pagination: %v", username, err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
 	}
-	users, err := ctrl.userService.GetUsersList(userID, "user", paginator)
+	users, total, err := ctrl.userService.GetFeed(user, "user", ctrl.ranker, (page-1)*limit, limit)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "user",
 			"service":   "gorm",
-		}).Errorf("server could not filtering by searching alg for user: %v, due to error GetUsersList: %v", username, err.Error())
+		}).Errorf("server could not filtering by searching alg for user: %v, due to error GetFeed: %v", username, err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	pageInfo := &pagination.PageInfo{
+		HasNext:   page*limit < total,
+		HasPrev:   page > 1,
+		TotalRows: total,
+	}
+	if pageInfo.HasNext {
+		pageInfo.Next = strconv.Itoa(page + 1)
+	}
+	if pageInfo.HasPrev {
+		pageInfo.Prev = strconv.Itoa(page - 1)
+	}
 	c.JSON(http.StatusOK, utils.UsersListResponse{
 		Result:     true,
 		Users:      users,
-		Pagination: paginator.PageInfo,
+		Pagination: pageInfo,
 	})
 }
 
@@ -435,10 +487,16 @@ type InputGrade struct {
 
 // @Summary to Grade profiles
 // @Tags user
+// @Description InterType is like, dislike or superlike. Likes and superlikes are limited per day by the plan, a superlike notifies the target and puts the user higher in the target's feed
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "With the Bearer started"
 // @Param InputGrade body InputGrade true "Input for Grade other profile"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
 // @Router /u/grade [post]
 func (ctrl *UserController) GradeProfileController(c *gin.Context) {
 	username := c.MustGet("username").(string)
@@ -451,13 +509,6 @@ func (ctrl *UserController) GradeProfileController(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
-	if user.RestrictionEnd.After(time.Now()) && !(user.RestrictionEnd.IsZero()) {
-		logger.Log.WithFields(logrus.Fields{
-			"component": "user",
-		}).Infof("user with username: %v, have restriction for liking other users which expire at %02d-%02d-%04d", username, user.RestrictionEnd.Month(), user.RestrictionEnd.Day(), user.RestrictionEnd.Month())
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("you have restriction for interaction expire at %02d-%02d", user.RestrictionEnd.Month(), user.RestrictionEnd.Day())})
-		return
-	}
 	var input InputGrade
 	if err := c.ShouldBind(&input); err != nil {
 		logger.Log.WithFields(logrus.Fields{
@@ -467,33 +518,57 @@ func (ctrl *UserController) GradeProfileController(c *gin.Context) {
 		return
 	}
 	InterType := input.InterType
-	if InterType != "like" && InterType != "dislike" {
+	if InterType != models.InteractionLike && InterType != models.InteractionDislike && InterType != models.InteractionSuperlike {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "user",
-		}).Debug("client send invalid data with error: Interaction should be 'like' or 'dislike'")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Interaction should be 'like' or 'dislike'"})
+		}).Debug("client send invalid data with error: Interaction should be 'like', 'dislike' or 'superlike'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Interaction should be 'like', 'dislike' or 'superlike'"})
 		return
 	}
 	targetId := input.TargetID
+	// blocked users are invisible to each other, so they can't be graded either
+	if blocked, err := ctrl.moderationService.IsBlocked(user.ID, targetId); err != nil || blocked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	// dislikes are not limited
+	var quota *service.Quota
+	quotaAction := ""
+	switch InterType {
+	case models.InteractionLike:
+		quotaAction = service.QuotaLikes
+	case models.InteractionSuperlike:
+		quotaAction = service.QuotaSuperlikes
+	}
+	if quotaAction != "" {
+		if quota, err = ctrl.useQuota(c, user, quotaAction); err != nil {
+			return
+		}
+	}
+
 	var interaction models.UserInteraction
 	interaction.TargetID = targetId
 	interaction.UserID = user.ID
 	interaction.InteractionType = InterType
 
-	if InterType == "like" {
+	matched := false
+	if models.IsLikeInteraction(InterType) {
 		var reverseInteraction models.UserInteraction
-		if err := config.DB.Where("user_id = ? AND target_id = ? AND interaction_type = ?", targetId, user.ID, "like").First(&reverseInteraction).Error; err == nil {
+		if err := config.DB.Where("user_id = ? AND target_id = ? AND interaction_type IN ?", targetId, user.ID, models.LikeInteractions).First(&reverseInteraction).Error; err == nil {
+			matched = true
 			interaction.IsRelevant = false
 			reverseInteraction.IsRelevant = false
 			if err := config.DB.Save(&reverseInteraction).Error; err != nil {
+				ctrl.refundQuota(user, quotaAction)
 				logger.Log.WithFields(logrus.Fields{
-                    "component": "user",
-                    "service":   "gorm",
-                    "target_id": reverseInteraction.TargetID,
-                    "user_id":   reverseInteraction.UserID,
-                }).Errorf("server could not update reverse interaction with error: %v", err.Error())
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not update reverse interaction"})
-                return
+					"component": "user",
+					"service":   "gorm",
+					"target_id": reverseInteraction.TargetID,
+					"user_id":   reverseInteraction.UserID,
+				}).Errorf("server could not update reverse interaction with error: %v", err.Error())
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not update reverse interaction"})
+				return
 			}
 
 			chat := models.Chat{
@@ -502,19 +577,22 @@ func (ctrl *UserController) GradeProfileController(c *gin.Context) {
 			}
 			err := ctrl.chatService.CreateChat(&chat)
 			if err != nil {
+				ctrl.refundQuota(user, quotaAction)
 				logger.Log.WithFields(logrus.Fields{
 					"component": "chat",
-					"user1_id": user.ID,
-					"user2_id": targetId,
+					"user1_id":  user.ID,
+					"user2_id":  targetId,
 				}).Errorf("server could not create chat with error: %v", err.Error())
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not create chat"})
 				return
 			}
+			ctrl.notifyMatch(&chat, user)
 		} else {
 			interaction.IsRelevant = true
 		}
 	}
 	if err := config.DB.Create(&interaction).Error; err != nil {
+		ctrl.refundQuota(user, quotaAction)
 		logger.Log.WithFields(logrus.Fields{
 			"component": "user",
 			"service":   "gorm",
@@ -524,29 +602,258 @@ func (ctrl *UserController) GradeProfileController(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not create interaction"})
 		return
 	}
-	userInteractionsCount, err := ctrl.userService.GetUserInteractionsCount(user.ID)
+	// a superlike which made a match is announced as the match
+	if InterType == models.InteractionSuperlike && !matched {
+		ws.Publish(ws.EventSuperlike, ws.NewSuperlikePayload(user), targetId)
+	}
+	c.JSON(http.StatusOK, gin.H{"quota": quota})
+}
+
+// @Summary Change email
+// @Tags user
+// @Description Sends a confirmation link to the new email, the change is applied after it is opened
+// @Description Accounts without password send the 2FA code, without 2FA they must have logged in within the last 10 minutes
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param input body ChangeEmailInput true "New email and the password, or the 2FA code for accounts without password"
+// @Success 202 {object} utils.MessageResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /u/change-email [post]
+func (ctrl *UserController) ChangeEmailController(c *gin.Context) {
+	var input ChangeEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !utils.IsValidEmailFormat(input.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email format is invalid"})
+		return
+	}
+	username := c.MustGet("username").(string)
+	if !allowRequest(c, "change_email:"+username, 3, time.Hour) {
+		return
+	}
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !reauthenticate(c, &ctrl.userService, &ctrl.sessionService, user, input.ReauthInput) {
+		return
+	}
+	if strings.EqualFold(input.Email, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This is your current email"})
+		return
+	}
+	exists, err := ctrl.userService.IsExistsEmail(input.Email)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"component": "user",
 			"service":   "gorm",
-		}).Errorf("server could not get count of interactions with error: %v", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not get count of interactions"})
+		}).Errorf("databse service could not check email with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "This email is already used by another account"})
+		return
+	}
+	if err := startEmailChange(&ctrl.userService, user, input.Email); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("server could not start email change with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not start email change"})
 		return
 	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your new email to confirm the change"})
+}
 
-	// Check if the user is subscribed if not
-	// if subscriber {limit = 100} else {limit = 10} countOfInteraction%limit == 0 && != 0
-	if userInteractionsCount%10 == 0 && userInteractionsCount != 0 {
-		RestrictionEnd := time.Now().Add(24 * time.Hour)
-		user.RestrictionEnd = RestrictionEnd
-		if err := config.DB.Save(&user).Error; err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"component": "user",
-			}).Errorf("server could not set restriction_end field for user: %v with error: %v", username, err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+type ChangeEmailInput struct {
+	Email string `json:"email" binding:"required"`
+	ReauthInput
+}
+
+// @Summary Cancel email change
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 204
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /u/change-email [delete]
+func (ctrl *UserController) CancelEmailChangeController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	user.PendingEmail = ""
+	user.EmailChangeHash = ""
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+		}).Errorf("databse service could not cancel email change with error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not cancel email change"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// notifyMatch pushes match.new to both users, each of them gets the profile of the other one.
+func (ctrl *UserController) notifyMatch(chat *models.Chat, user *models.User) {
+	target, err := ctrl.userService.GetUserByID(chat.OtherMember(user.ID))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+			"chat_id":   chat.ID,
+		}).Errorf("server could not load matched user with error: %v", err.Error())
+		return
+	}
+	ws.Publish(ws.EventMatchNew, ws.NewMatchPayload(chat.ID, target), user.ID)
+	ws.Publish(ws.EventMatchNew, ws.NewMatchPayload(chat.ID, user), target.ID)
+}
+
+type PrivacyInput struct {
+	HidePresence *bool `json:"hide_presence" binding:"required"`
+}
+
+// @Summary Privacy settings
+// @Tags user
+// @Description Hides online status and last seen time from other users
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param input body PrivacyInput true "Privacy settings"
+// @Success 204
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /u/privacy [patch]
+func (ctrl *UserController) PrivacyController(c *gin.Context) {
+	var input PrivacyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	user.HidePresence = *input.HidePresence
+	if err := ctrl.userService.UpdateUser(user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"service":   "gorm",
+		}).Errorf("databse service could not update privacy settings of user: %v, with err: %v", username, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server could not update privacy settings"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type DiscoveryPreferencesInput struct {
+	Genders       []string `json:"genders" binding:"required"`
+	MinAge        uint8    `json:"min_age" binding:"required"`
+	MaxAge        uint8    `json:"max_age" binding:"required"`
+	MaxDistanceKm uint     `json:"max_distance_km"`
+	PhotosOnly    bool     `json:"photos_only"`
+}
+
+// @Summary Discovery preferences
+// @Tags user
+// @Description Preferences used for profiles and likes lists, defaults are returned until the user saves own
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Success 200 {object} models.DiscoveryPreferences
+// @Failure 500 {object} ErrorResponse
+// @Router /u/discovery-preferences [get]
+func (ctrl *UserController) GetDiscoveryPreferencesController(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	prefs, err := ctrl.userService.GetDiscoveryPreferences(user)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("could not get discovery preferences with err: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to get discovery preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// @Summary Update discovery preferences
+// @Tags user
+// @Description Genders are any of male, female, non_binary; ages are 18-100; max_distance_km = 0 disables the distance limit.
+// @Description Profiles are shown only when the preferences of both users match.
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "With the Bearer started"
+// @Param DiscoveryPreferencesInput body DiscoveryPreferencesInput true "Preferences"
+// @Success 200 {object} models.DiscoveryPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /u/discovery-preferences [put]
+func (ctrl *UserController) UpdateDiscoveryPreferencesController(c *gin.Context) {
+	var input DiscoveryPreferencesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Genders) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "choose at least one gender"})
+		return
+	}
+	genders := make([]string, 0, len(input.Genders))
+	for _, gender := range input.Genders {
+		if !models.IsValidSex(gender) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "genders must be any of " + strings.Join(models.Sexes, ", ")})
 			return
 		}
+		if !slices.Contains(genders, gender) {
+			genders = append(genders, gender)
+		}
+	}
+	if input.MinAge < models.MinDiscoveryAge || input.MaxAge > models.MaxDiscoveryAge || input.MinAge > input.MaxAge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("age range must be within %d-%d", models.MinDiscoveryAge, models.MaxDiscoveryAge)})
+		return
 	}
-	c.Status(http.StatusOK)
 
+	username := c.MustGet("username").(string)
+	user, err := ctrl.userService.GetUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	prefs := models.DiscoveryPreferences{
+		UserID:        user.ID,
+		Genders:       genders,
+		MinAge:        input.MinAge,
+		MaxAge:        input.MaxAge,
+		MaxDistanceKm: input.MaxDistanceKm,
+		PhotosOnly:    input.PhotosOnly,
+	}
+	if err := ctrl.userService.SaveDiscoveryPreferences(&prefs); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "user",
+			"username":  username,
+		}).Errorf("could not save discovery preferences with err: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save discovery preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
 }
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (p *publishedEvents) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]string, len(p.events))
+	for i, event := range p.events {
+		types[i] = event.Event.Type
+	}
+	return types
+}
+
+func editProfile(ctrl *UserController, username string, form url.Values) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.PUT("/u/profile", func(c *gin.Context) {
+		c.Set("username", username)
+		ctrl.EditProfileController(c)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/u/profile", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTimezoneChangesAreLimited(t *testing.T) {
+	ctrl := newTestUserController()
+	user := createTestUser(t, "timezone_user")
+	profile := func(timezone string) url.Values {
+		return url.Values{"age": {"30"}, "timezone": {timezone}}
+	}
+
+	require.Equal(t, http.StatusOK, editProfile(ctrl, user.Username, profile("Pacific/Kiritimati")).Code)
+	w := editProfile(ctrl, user.Username, profile("Pacific/Pago_Pago"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	// sending the same timezone again is not a change
+	assert.Equal(t, http.StatusOK, editProfile(ctrl, user.Username, profile("Pacific/Kiritimati")).Code)
+
+	stored, err := ctrl.userService.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Pacific/Kiritimati", stored.Timezone)
+
+	changedAt := time.Now().Add(-config.TimezoneChangeInterval - time.Minute)
+	require.NoError(t, config.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("timezone_changed_at", changedAt).Error)
+	assert.Equal(t, http.StatusOK, editProfile(ctrl, user.Username, profile("Pacific/Pago_Pago")).Code)
+}
+
+func TestSuperlikeIsPublishedAfterInsert(t *testing.T) {
+	ctrl := newTestUserController()
+	grade := func(user models.User, target models.User, interType string) int {
+		body := fmt.Sprintf(`{"TargetID": %d, "InterType": %q}`, target.ID, interType)
+		return serveAs(user.Username, http.MethodPost, "/u/grade", body, "/u/grade", ctrl.GradeProfileController).Code
+	}
+	alice := createTestUser(t, "superlike_alice")
+	bob := createTestUser(t, "superlike_bob")
+
+	published := capturePublished(t)
+	require.Equal(t, http.StatusOK, grade(alice, bob, models.InteractionSuperlike))
+	assert.Equal(t, []string{ws.EventSuperlike}, published.types())
+
+	// the superlike back makes a match, only the match is announced
+	published = capturePublished(t)
+	require.Equal(t, http.StatusOK, grade(bob, alice, models.InteractionSuperlike))
+	assert.NotContains(t, published.types(), ws.EventSuperlike)
+	assert.NotEmpty(t, published.types())
+}
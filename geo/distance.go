@@ -0,0 +1,31 @@
+// Package geo has distance helpers and spatial indexes for users' locations.
+package geo
+
+import (
+	"math"
+	"strconv"
+)
+
+const EarthRadiusKm = 6371
+
+// KmPerDegree is the length of one degree of latitude.
+const KmPerDegree = 111.32
+
+// Haversine is the great-circle distance in km between two points.
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*math.Pi/180.0)*math.Cos(lat2*math.Pi/180.0)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return EarthRadiusKm * c
+}
+
+// HasLocation reports whether the point was set, users without location have 0, 0.
+func HasLocation(lat, lon float64) bool {
+	return lat != 0 || lon != 0
+}
+
+// sqlFloat formats a coordinate as a SQL literal.
+func sqlFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,99 @@
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxGeohashPrecision is the length of geohashes stored for users, about 1 m.
+const MaxGeohashPrecision = 12
+
+// EncodeGeohash returns the geohash of the point with the given number of characters.
+func EncodeGeohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	var hash strings.Builder
+	bit, ch, even := 0, 0, true
+	for hash.Len() < precision {
+		var r *[2]float64
+		value := lat
+		if even {
+			r, value = &lonRange, lon
+		} else {
+			r = &latRange
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if value >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash.WriteByte(base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// cellSize returns the height and width of a geohash cell in degrees.
+func cellSize(precision int) (float64, float64) {
+	bits := precision * 5
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// GeohashPrecisionFor returns the longest geohash whose cell is still at least
+// radiusKm in both directions at the latitude, so the cell and its neighbours
+// cover the circle.
+func GeohashPrecisionFor(radiusKm float64, lat float64) int {
+	for precision := MaxGeohashPrecision; precision > 1; precision-- {
+		height, width := cellSize(precision)
+		widthKm := width * KmPerDegree * math.Cos(lat*math.Pi/180)
+		if height*KmPerDegree >= radiusKm && widthKm >= radiusKm {
+			return precision
+		}
+	}
+	return 1
+}
+
+// GeohashNeighbours returns the cell of the point with the given precision and
+// the 8 cells around it. Cells beyond the poles are skipped.
+func GeohashNeighbours(lat, lon float64, precision int) []string {
+	height, width := cellSize(precision)
+	seen := make(map[string]bool, 9)
+	cells := make([]string, 0, 9)
+	for _, dLat := range []float64{-height, 0, height} {
+		cellLat := lat + dLat
+		if cellLat < -90 || cellLat > 90 {
+			continue
+		}
+		for _, dLon := range []float64{-width, 0, width} {
+			cellLon := math.Mod(lon+dLon+540, 360) - 180
+			hash := EncodeGeohash(cellLat, cellLon, precision)
+			if !seen[hash] {
+				seen[hash] = true
+				cells = append(cells, hash)
+			}
+		}
+	}
+	return cells
+}
+
+// geohashPrefixEnd returns the smallest geohash after all geohashes starting with
+// prefix, it is the next cell of the same length. The last cells ("z", "zz", ...)
+// have no end.
+func geohashPrefixEnd(prefix string) (string, bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if pos := strings.IndexByte(base32, prefix[i]); pos < len(base32)-1 {
+			return prefix[:i] + string(base32[pos+1]), true
+		}
+	}
+	return "", false
+}
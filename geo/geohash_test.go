@@ -0,0 +1,125 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cosDeg(lat float64) float64 {
+	return math.Cos(lat * math.Pi / 180)
+}
+
+func TestEncodeGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{0, 0, 1, "s"},
+		{-90, -180, 4, "0000"},
+		{90, 180, 4, "zzzz"},
+		{57.64911, 10.40744, 3, "u4p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, EncodeGeohash(tt.lat, tt.lon, tt.precision))
+		})
+	}
+}
+
+func TestGeohashNeighbours(t *testing.T) {
+	t.Run("around the cell", func(t *testing.T) {
+		cells := GeohashNeighbours(57.64911, 10.40744, 3)
+		assert.Len(t, cells, 9)
+		assert.ElementsMatch(t, []string{"u1y", "u1z", "u3b", "u4n", "u4p", "u4q", "u4r", "u60", "u62"}, cells)
+	})
+	t.Run("pole", func(t *testing.T) {
+		// the row beyond the pole doesn't exist
+		cells := GeohashNeighbours(89.9, 10, 2)
+		assert.Len(t, cells, 6)
+		assert.Contains(t, cells, EncodeGeohash(89.9, 10, 2))
+		assert.Contains(t, cells, EncodeGeohash(89.9-5.625, 10, 2))
+	})
+	t.Run("south pole", func(t *testing.T) {
+		cells := GeohashNeighbours(-89.9, 10, 2)
+		assert.Len(t, cells, 6)
+		assert.Contains(t, cells, EncodeGeohash(-89.9, 10, 2))
+	})
+	t.Run("antimeridian", func(t *testing.T) {
+		// the cells east of 180 are the western cells at -180
+		cells := GeohashNeighbours(0.1, 179.9, 3)
+		assert.Len(t, cells, 9)
+		assert.Contains(t, cells, EncodeGeohash(0.1, 179.9, 3))
+		assert.Contains(t, cells, EncodeGeohash(0.1, -179.9, 3))
+		assert.Contains(t, cells, EncodeGeohash(-1, -179.9, 3))
+	})
+	t.Run("no duplicates", func(t *testing.T) {
+		// at precision 1 the cell is a quarter of the globe wide, neighbours repeat
+		cells := GeohashNeighbours(60, 0, 1)
+		seen := map[string]bool{}
+		for _, cell := range cells {
+			assert.False(t, seen[cell], "duplicate cell %s", cell)
+			seen[cell] = true
+		}
+	})
+}
+
+func TestGeohashPrecisionFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		radiusKm float64
+		lat      float64
+		want     int
+	}{
+		{"city at the equator", 50, 0, 3},
+		{"neighbourhood at the equator", 1, 0, 5},
+		{"continent", 5000, 0, 1},
+		{"cells narrow towards the poles", 50, 80, 2},
+		{"pole", 1, 90, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			precision := GeohashPrecisionFor(tt.radiusKm, tt.lat)
+			assert.Equal(t, tt.want, precision)
+		})
+	}
+	for _, radiusKm := range []float64{0.01, 0.5, 3, 20, 100, 600} {
+		for _, lat := range []float64{0, 45, 70} {
+			precision := GeohashPrecisionFor(radiusKm, lat)
+			height, width := cellSize(precision)
+			widthKm := width * KmPerDegree * cosDeg(lat)
+			assert.GreaterOrEqual(t, height*KmPerDegree, radiusKm, "radius %v at %v", radiusKm, lat)
+			assert.GreaterOrEqual(t, widthKm, radiusKm, "radius %v at %v", radiusKm, lat)
+			if precision < MaxGeohashPrecision {
+				height, width = cellSize(precision + 1)
+				assert.True(t, height*KmPerDegree < radiusKm || width*KmPerDegree*cosDeg(lat) < radiusKm,
+					"precision %d is not the longest for radius %v at %v", precision, radiusKm, lat)
+			}
+		}
+	}
+}
+
+func TestGeohashPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"u4p", "u4q", true},
+		{"u49", "u4b", true},
+		{"u4z", "u5", true},
+		{"bzz", "c", true},
+		{"zzz", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			end, ok := geohashPrefixEnd(tt.prefix)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, end)
+		})
+	}
+}
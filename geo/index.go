@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SpatialIndex narrows and orders queries on the users table by distance
+// from a point. Users without location never match a radius.
+type SpatialIndex interface {
+	Name() string
+	// Near keeps users within radiusKm of the point.
+	Near(db *gorm.DB, lat, lon, radiusKm float64) *gorm.DB
+	// NearByColumn keeps users for whom the point is within the radius in km
+	// stored in the column, NULL or 0 means no limit.
+	NearByColumn(db *gorm.DB, lat, lon float64, column string) *gorm.DB
+	// OrderByDistance sorts users from the closest to the point.
+	OrderByDistance(db *gorm.DB, lat, lon float64) *gorm.DB
+}
+
+// NewSpatialIndex prepares the database and picks PostGIS when it can be
+// enabled, otherwise geohash prefixes are used.
+func NewSpatialIndex(db *gorm.DB) (SpatialIndex, error) {
+	if db.Dialector.Name() == "postgres" {
+		if err := setupPostGIS(db); err == nil {
+			return PostGISIndex{}, nil
+		}
+	}
+	if err := backfillGeohashes(db); err != nil {
+		return nil, err
+	}
+	return GeohashIndex{}, nil
+}
+
+// backfillGeohashes fills geohashes of users saved before the column existed.
+func backfillGeohashes(db *gorm.DB) error {
+	var users []struct {
+		ID       uint
+		Lat, Lon float64
+	}
+	if err := db.Table("users").Select("id, lat, lon").
+		Where("(geohash IS NULL OR geohash = '') AND (lat <> 0 OR lon <> 0)").
+		Scan(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := db.Table("users").Where("id = ?", u.ID).
+			UpdateColumn("geohash", EncodeGeohash(u.Lat, u.Lon, MaxGeohashPrecision)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GeohashIndex uses the users.geohash prefix for the index lookup and a flat
+// earth approximation for the distance, it needs no database extensions so it
+// works with sqlite as well. Distances are not exact near the poles and across
+// the antimeridian.
+type GeohashIndex struct{}
+
+func (GeohashIndex) Name() string { return "geohash" }
+
+// squaredDistance is the squared distance in km between users and the point.
+// It is plain SQL because gorm can't bind variables in ORDER BY.
+func squaredDistance(lat, lon float64) string {
+	lonKm := KmPerDegree * math.Cos(lat*math.Pi/180)
+	dLat := fmt.Sprintf("((users.lat - %s) * %s)", sqlFloat(lat), sqlFloat(KmPerDegree))
+	dLon := fmt.Sprintf("((users.lon - %s) * %s)", sqlFloat(lon), sqlFloat(lonKm))
+	return dLat + " * " + dLat + " + " + dLon + " * " + dLon
+}
+
+// prefixRanges matches geohashes starting with any of the cells. Every prefix is
+// a range of the column, so the index on users.geohash serves the lookup.
+func prefixRanges(cells []string) (string, []interface{}) {
+	conditions := make([]string, 0, len(cells))
+	vars := make([]interface{}, 0, 2*len(cells))
+	for _, cell := range cells {
+		if end, ok := geohashPrefixEnd(cell); ok {
+			conditions = append(conditions, "(users.geohash >= ? AND users.geohash < ?)")
+			vars = append(vars, cell, end)
+		} else {
+			conditions = append(conditions, "users.geohash >= ?")
+			vars = append(vars, cell)
+		}
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", vars
+}
+
+func (GeohashIndex) Near(db *gorm.DB, lat, lon, radiusKm float64) *gorm.DB {
+	precision := GeohashPrecisionFor(radiusKm, lat)
+	ranges, vars := prefixRanges(GeohashNeighbours(lat, lon, precision))
+	return db.Where(ranges, vars...).
+		Where(squaredDistance(lat, lon)+" <= ?", radiusKm*radiusKm)
+}
+
+func (GeohashIndex) NearByColumn(db *gorm.DB, lat, lon float64, column string) *gorm.DB {
+	return db.Where("(COALESCE(" + column + ", 0) = 0 OR " + squaredDistance(lat, lon) + " <= " + column + " * " + column + ")")
+}
+
+func (GeohashIndex) OrderByDistance(db *gorm.DB, lat, lon float64) *gorm.DB {
+	// users without location go last
+	return db.Order("CASE WHEN users.lat = 0 AND users.lon = 0 THEN 1 ELSE 0 END").
+		Order(squaredDistance(lat, lon))
+}
@@ -0,0 +1,51 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type testUser struct {
+	ID       uint
+	Name     string
+	Lat, Lon float64
+	Geohash  string `gorm:"index"`
+}
+
+func (testUser) TableName() string { return "users" }
+
+func TestGeohashIndexNear(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:geo_test?mode=memory"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&testUser{}))
+	for _, user := range []testUser{
+		{Name: "center", Lat: 55.75, Lon: 37.62},
+		{Name: "near", Lat: 55.80, Lon: 37.70},
+		{Name: "far", Lat: 59.94, Lon: 30.31},
+		{Name: "across_antimeridian", Lat: 0.1, Lon: -179.95},
+		{Name: "nowhere"},
+	} {
+		require.NoError(t, db.Create(&user).Error)
+	}
+	require.NoError(t, backfillGeohashes(db))
+
+	near := func(lat, lon, radiusKm float64) []string {
+		var names []string
+		require.NoError(t, GeohashIndex{}.Near(db.Model(&testUser{}), lat, lon, radiusKm).
+			Order("id").Pluck("name", &names).Error)
+		return names
+	}
+	assert.Equal(t, []string{"center", "near"}, near(55.75, 37.62, 20))
+	assert.Equal(t, []string{"center"}, near(55.75, 37.62, 1))
+	assert.Empty(t, near(0, 0, 50))
+
+	// the lookup is a range of the indexed column
+	stmt := GeohashIndex{}.Near(db.Session(&gorm.Session{DryRun: true}).Model(&testUser{}), 55.75, 37.62, 20).
+		Find(&[]testUser{}).Statement
+	assert.Contains(t, stmt.SQL.String(), "users.geohash >= ? AND users.geohash < ?")
+	assert.NotContains(t, stmt.SQL.String(), "SUBSTR")
+}
@@ -0,0 +1,61 @@
+package geo
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// setupPostGIS adds users.location kept in sync with lat/lon by a trigger.
+// It fails when the extension is not installed or can't be created.
+func setupPostGIS(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"CREATE EXTENSION IF NOT EXISTS postgis",
+			"ALTER TABLE users ADD COLUMN IF NOT EXISTS location geography(Point, 4326)",
+			"CREATE INDEX IF NOT EXISTS idx_users_location ON users USING GIST (location)",
+			`CREATE OR REPLACE FUNCTION users_sync_location() RETURNS trigger AS $$
+			BEGIN
+				IF NEW.lat = 0 AND NEW.lon = 0 THEN
+					NEW.location := NULL;
+				ELSE
+					NEW.location := ST_SetSRID(ST_MakePoint(NEW.lon, NEW.lat), 4326)::geography;
+				END IF;
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql`,
+			"DROP TRIGGER IF EXISTS users_sync_location ON users",
+			"CREATE TRIGGER users_sync_location BEFORE INSERT OR UPDATE OF lat, lon ON users FOR EACH ROW EXECUTE FUNCTION users_sync_location()",
+			`UPDATE users SET location = ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography
+			WHERE location IS NULL AND (lat <> 0 OR lon <> 0)`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PostGISIndex uses the GiST index on users.location.
+type PostGISIndex struct{}
+
+func (PostGISIndex) Name() string { return "postgis" }
+
+func point(lat, lon float64) string {
+	return fmt.Sprintf("ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography", sqlFloat(lon), sqlFloat(lat))
+}
+
+func (PostGISIndex) Near(db *gorm.DB, lat, lon, radiusKm float64) *gorm.DB {
+	return db.Where("ST_DWithin(users.location, "+point(lat, lon)+", ?)", radiusKm*1000)
+}
+
+func (PostGISIndex) NearByColumn(db *gorm.DB, lat, lon float64, column string) *gorm.DB {
+	return db.Where("(COALESCE(" + column + ", 0) = 0 OR ST_DWithin(users.location, " + point(lat, lon) + ", " + column + " * 1000))")
+}
+
+func (PostGISIndex) OrderByDistance(db *gorm.DB, lat, lon float64) *gorm.DB {
+	// <-> is answered by the GiST index, users without location go last
+	return db.Order("users.location <-> " + point(lat, lon) + " NULLS LAST")
+}
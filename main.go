@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,7 @@ import (
 	"github.com/ilyaDyb/go_rest_api/middleware"
 	"github.com/ilyaDyb/go_rest_api/pereodictasks"
 	"github.com/ilyaDyb/go_rest_api/routes"
+	"github.com/ilyaDyb/go_rest_api/utils"
 	"github.com/ilyaDyb/go_rest_api/ws"
 	"github.com/sirupsen/logrus"
 	swaggerfiles "github.com/swaggo/files"
@@ -57,9 +59,31 @@ func main() {
 		panic(err)
 	}
 	logger.InitLogger(client)
+
+	if err := utils.LoadSigningKeys(); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "jwt",
+		}).Fatalf("could not load jwt signing keys: %v", err)
+		log.Fatalf("could not load jwt signing keys: %v", err)
+	}
 	
 	config.Connect()
-	router := gin.Default()
+	config.LoadOAuthProviders()
+	config.LoadPaymentProviders()
+	if err := config.LoadRankingWeights(); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "ranking",
+		}).Fatalf("could not load ranking weights: %v", err)
+		log.Fatalf("could not load ranking weights: %v", err)
+	}
+	router := gin.New()
+	router.Use(middleware.RequestLogger(), gin.Recovery())
+	if err := router.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "gin",
+		}).Fatalf("invalid TRUSTED_PROXIES: %v", err)
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 	
 	// router.Use(cors.Default())
 	router.Use(middleware.CORSMiddleware())
@@ -69,9 +93,23 @@ func main() {
 	routes.UserRoute(router)
 	routes.ChatRoute(router)
 	routes.AdminRoute(router)
+	routes.PaymentRoute(router)
 
 	ws.RegisterWsRoutes(router)
-	go ws.HubInstance.Run()
+	broker, err := ws.NewBroker(os.Getenv("WS_BROKER"), redis.RedisClient)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "websocket",
+		}).Fatalf("could not create websocket broker: %v", err)
+		log.Fatalf("could not create websocket broker: %v", err)
+	}
+	ws.HubInstance.Broker = broker
+	if err := ws.HubInstance.Start(); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "websocket",
+		}).Fatalf("could not start websocket hub: %v", err)
+		log.Fatalf("could not start websocket hub: %v", err)
+	}
 
 	log.Println("Calling run server...")
 	go func() {
@@ -1,14 +1,39 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
 	"github.com/ilyaDyb/go_rest_api/utils"
 )
 
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrSessionRevoked = errors.New("session was revoked")
+)
+
+// ValidateAccessToken checks the access token and its session, it is shared with
+// the websocket handler which can't use the Authorization header.
+func ValidateAccessToken(sessionService service.SessionService, tokenStr string) (*utils.Claims, error) {
+	claims, err := utils.ParseJWT(tokenStr)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	// access tokens stay valid only while their session was not revoked
+	session, err := sessionService.GetSession(claims.SessionID)
+	if err != nil || session.Username != claims.Username {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
 func JWTAuthMiddleware() gin.HandlerFunc {
+	sessionService := service.NewSessionService(repository.NewRedisSessionRepo(redis.RedisClient))
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -23,14 +48,21 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		tokenStr := parts[1]
-		claims, err := utils.ParseJWT(tokenStr)
+		claims, err := ValidateAccessToken(sessionService, tokenStr)
+		if err == ErrSessionRevoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session was revoked"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-		
+
 		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sensitiveQueryParams carry one-time secrets (ws/magic-link tokens, email
+// confirmation hashes, OAuth codes) and must never reach the access log.
+var sensitiveQueryParams = map[string]bool{
+	"token": true,
+	"hash":  true,
+	"code":  true,
+	"state": true,
+}
+
+// RequestLogger is gin's default access logger with the values of
+// sensitiveQueryParams replaced by REDACTED.
+func RequestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		var statusColor, methodColor, resetColor string
+		if param.IsOutputColor() {
+			statusColor = param.StatusCodeColor()
+			methodColor = param.MethodColor()
+			resetColor = param.ResetColor()
+		}
+
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, param.StatusCode, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			redactQuery(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactQuery masks sensitive query values in path while keeping the
+// parameter order and every other value untouched.
+func redactQuery(path string) string {
+	base, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && sensitiveQueryParams[name] {
+			pairs[i] = key + "=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(pairs, "&")
+}
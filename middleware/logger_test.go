@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"no query", "/api/v1/user/profile", "/api/v1/user/profile"},
+		{"ws token", "/ws?token=secret", "/ws?token=REDACTED"},
+		{"magic link", "/auth/magic-link/verify?token=abc", "/auth/magic-link/verify?token=REDACTED"},
+		{"confirm hash", "/auth/confirm?hash=abc&user=1", "/auth/confirm?hash=REDACTED&user=1"},
+		{"oauth callback", "/auth/oauth/google/callback?state=s&code=c", "/auth/oauth/google/callback?state=REDACTED&code=REDACTED"},
+		{"escaped key", "/ws?%74oken=secret", "/ws?%74oken=REDACTED"},
+		{"other params kept", "/search?q=token&page=2", "/search?q=token&page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redactQuery(tt.path))
+		})
+	}
+}
+
+func TestRequestLoggerRedactsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &out
+	defer func() { gin.DefaultWriter = defaultWriter }()
+
+	router := gin.New()
+	router.Use(RequestLogger())
+	router.GET("/ws", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ws?token=secret", nil))
+
+	assert.Contains(t, out.String(), "/ws?token=REDACTED")
+	assert.NotContains(t, out.String(), "secret")
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/sirupsen/logrus"
+)
+
+// RequirePermission must be used after JWTAuthMiddleware, it relies on the role
+// which was taken from the token claims.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, permission := range permissions {
+			if !models.HasPermission(role, permission) {
+				logger.Log.WithFields(logrus.Fields{
+					"component":  "auth",
+					"username":   c.GetString("username"),
+					"role":       role,
+					"permission": permission,
+				}).Info("access denied for user without permission")
+				c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this resource"})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -12,20 +14,50 @@ type Chat struct {
 
 	User1 User `gorm:"foreignKey:User1ID;constraint:OnDelete:CASCADE;" json:"user1,omitempty"`
 	User2 User `gorm:"foreignKey:User2ID;constraint:OnDelete:CASCADE;" json:"user2,omitempty"`
+
+	// ClosedAt is set on unmatch or block, closed chats are hidden from both users
+	// and kept only for moderators.
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+	ClosedByID *uint      `json:"closed_by_id,omitempty"`
 }
 
 func (Chat) TableName() string {
 	return "chats"
 }
 
+// HasMember reports whether the user is one of the two participants of the chat.
+func (chat *Chat) HasMember(userID uint) bool {
+	return chat.User1ID == userID || chat.User2ID == userID
+}
+
+// OtherMember returns the id of the participant who is not userID.
+func (chat *Chat) OtherMember(userID uint) uint {
+	if chat.User1ID == userID {
+		return chat.User2ID
+	}
+	return chat.User1ID
+}
+
 
 type Message struct {
 	gorm.Model
 	ChatID     uint   `gorm:"not null" json:"chat_id"`
-	SenderID   uint   `gorm:"not null" json:"sender_id"`
+	SenderID   uint   `gorm:"not null;uniqueIndex:idx_messages_sender_client_msg" json:"sender_id"`
 	ReceiverID uint   `gorm:"not null" json:"receiver_id"`
 	Content    string `gorm:"type:text;not null" json:"content"`
 	IsRead     bool   `gorm:"default:false" json:"is_read"`
+	// ReadAt is set when the receiver reports reading up to this message, IsRead follows it
+	ReadAt *time.Time `json:"read_at"`
+	// ClientMsgID is generated by the client, retries of the same message share it.
+	// It's a pointer so messages without it are stored as NULL and don't collide.
+	ClientMsgID *string `gorm:"size:64;uniqueIndex:idx_messages_sender_client_msg" json:"client_msg_id,omitempty"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+	// DeletedForEveryoneAt turns the message into a tombstone for both members,
+	// the content is kept in the database for moderators.
+	DeletedForEveryoneAt *time.Time `json:"deleted_for_everyone_at,omitempty"`
+	// Edits are loaded only for moderators
+	Edits       []MessageEdit `gorm:"foreignKey:MessageID" json:"edits,omitempty"`
+	Attachments []Attachment  `gorm:"foreignKey:MessageID" json:"attachments,omitempty"`
 
 	Chat     Chat `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"-"`
 	Sender   User `gorm:"foreignKey:SenderID;constraint:OnDelete:CASCADE;" json:"-"`
@@ -35,3 +67,47 @@ type Message struct {
 func (Message) TableName() string {
 	return "messages"
 }
+
+// Redact hides the content and attachments of the message deleted for everyone.
+func (m *Message) Redact() {
+	if m.DeletedForEveryoneAt != nil {
+		m.Content = ""
+		m.Attachments = nil
+	}
+}
+
+// MessageEdit keeps the content of the message before every edit.
+type MessageEdit struct {
+	gorm.Model
+	MessageID  uint   `gorm:"not null;index" json:"message_id"`
+	OldContent string `gorm:"type:text;not null" json:"old_content"`
+}
+
+// MessageHide is "delete for me": the message is hidden only for UserID.
+type MessageHide struct {
+	gorm.Model
+	MessageID uint `gorm:"not null;uniqueIndex:idx_message_hides_message_user" json:"message_id"`
+	UserID    uint `gorm:"not null;uniqueIndex:idx_message_hides_message_user" json:"user_id"`
+}
+
+const (
+	AttachmentImage = "image"
+	AttachmentGIF   = "gif"
+	AttachmentVideo = "video"
+	AttachmentVoice = "voice"
+)
+
+// Attachment is a file sent in a message. Path points to the file in the upload
+// storage and is never exposed, clients download the file by the attachment id.
+type Attachment struct {
+	gorm.Model
+	MessageID uint   `gorm:"not null;index" json:"message_id"`
+	Kind      string `gorm:"size:16;not null" json:"kind"`
+	MimeType  string `gorm:"size:128;not null" json:"mime_type"`
+	Size      int64  `gorm:"not null" json:"size"`
+	Path      string `gorm:"not null" json:"-"`
+}
+
+func (Attachment) TableName() string {
+	return "attachments"
+}
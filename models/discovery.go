@@ -0,0 +1,76 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	SexMale      = "male"
+	SexFemale    = "female"
+	SexNonBinary = "non_binary"
+)
+
+var Sexes = []string{SexMale, SexFemale, SexNonBinary}
+
+func IsValidSex(sex string) bool {
+	for _, s := range Sexes {
+		if s == sex {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	MinDiscoveryAge = 18
+	MaxDiscoveryAge = 100
+)
+
+// DiscoveryPreferences decide who the user is shown to and who is shown to the user,
+// both users' preferences must match. MaxDistanceKm = 0 means no distance limit.
+type DiscoveryPreferences struct {
+	gorm.Model
+	UserID        uint     `gorm:"not null;uniqueIndex" json:"user_id"`
+	Genders       []string `gorm:"type:text;not null;serializer:json" json:"genders"`
+	MinAge        uint8    `gorm:"not null;default:18" json:"min_age"`
+	MaxAge        uint8    `gorm:"not null;default:100" json:"max_age"`
+	MaxDistanceKm uint     `gorm:"not null;default:0" json:"max_distance_km"`
+	PhotosOnly    bool     `gorm:"not null;default:false" json:"photos_only"`
+}
+
+func (DiscoveryPreferences) TableName() string {
+	return "discovery_preferences"
+}
+
+// DefaultGenders keeps the behaviour from before preferences existed:
+// the opposite sex, everyone for non-binary users.
+func DefaultGenders(sex string) []string {
+	switch sex {
+	case SexMale:
+		return []string{SexFemale}
+	case SexFemale:
+		return []string{SexMale}
+	default:
+		return Sexes
+	}
+}
+
+// DefaultDiscoveryPreferences is used until the user saves own preferences.
+func DefaultDiscoveryPreferences(user *User) *DiscoveryPreferences {
+	return &DiscoveryPreferences{
+		UserID:  user.ID,
+		Genders: DefaultGenders(user.Sex),
+		MinAge:  MinDiscoveryAge,
+		MaxAge:  MaxDiscoveryAge,
+	}
+}
+
+// WantsGender reports whether the preferences include the sex.
+func (p *DiscoveryPreferences) WantsGender(sex string) bool {
+	for _, g := range p.Genders {
+		if g == sex {
+			return true
+		}
+	}
+	return false
+}
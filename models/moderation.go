@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Block hides the users from each other in both directions: profiles, likes, chats and events.
+type Block struct {
+	gorm.Model
+	BlockerID uint `gorm:"not null;uniqueIndex:idx_blocks_blocker_blocked" json:"blocker_id"`
+	BlockedID uint `gorm:"not null;uniqueIndex:idx_blocks_blocker_blocked;index" json:"blocked_id"`
+
+	Blocked User `gorm:"foreignKey:BlockedID;constraint:OnDelete:CASCADE;" json:"blocked,omitempty"`
+}
+
+func (Block) TableName() string {
+	return "blocks"
+}
+
+const (
+	ReportReasonSpam          = "spam"
+	ReportReasonHarassment    = "harassment"
+	ReportReasonInappropriate = "inappropriate_content"
+	ReportReasonFakeProfile   = "fake_profile"
+	ReportReasonUnderage      = "underage"
+	ReportReasonOther         = "other"
+)
+
+var ReportReasons = []string{
+	ReportReasonSpam,
+	ReportReasonHarassment,
+	ReportReasonInappropriate,
+	ReportReasonFakeProfile,
+	ReportReasonUnderage,
+	ReportReasonOther,
+}
+
+func IsValidReportReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// Report is a complaint about a user, open reports make the moderation queue.
+type Report struct {
+	gorm.Model
+	ReporterID uint   `gorm:"not null;index" json:"reporter_id"`
+	ReportedID uint   `gorm:"not null;index" json:"reported_id"`
+	Reason     string `gorm:"size:32;not null" json:"reason"`
+	Comment    string `gorm:"type:text" json:"comment"`
+	Status     string `gorm:"size:16;not null;default:open;index" json:"status"`
+	// Messages are the evidence, they must be from a chat between the two users
+	Messages []Message `gorm:"many2many:report_messages;" json:"messages,omitempty"`
+
+	ResolvedByID   *uint      `json:"resolved_by_id,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolutionNote string     `gorm:"type:text" json:"resolution_note,omitempty"`
+
+	Reporter User `gorm:"foreignKey:ReporterID;constraint:OnDelete:CASCADE;" json:"reporter,omitempty"`
+	Reported User `gorm:"foreignKey:ReportedID;constraint:OnDelete:CASCADE;" json:"reported,omitempty"`
+}
+
+func (Report) TableName() string {
+	return "reports"
+}
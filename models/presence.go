@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// Presence is the online status of a user, it lives only in the websocket broker.
+type Presence struct {
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
@@ -0,0 +1,49 @@
+package models
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+const (
+	PermUsersRead  = "users:read"
+	PermUsersWrite = "users:write"
+	PermChatsRead  = "chats:read"
+
+	PermReportsRead  = "reports:read"
+	PermReportsWrite = "reports:write"
+
+	PermSubscriptionsWrite = "subscriptions:write"
+
+	PermSettingsWrite = "settings:write"
+)
+
+// RolePermissions maps every role to the set of permissions it grants.
+// Support staff get read-only access to the admin panel.
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermUsersRead,
+		PermUsersWrite,
+		PermChatsRead,
+		PermReportsRead,
+		PermReportsWrite,
+		PermSubscriptionsWrite,
+		PermSettingsWrite,
+	},
+	RoleSupport: {
+		PermUsersRead,
+		PermChatsRead,
+		PermReportsRead,
+	},
+	RoleUser: {},
+}
+
+func HasPermission(role string, permission string) bool {
+	for _, p := range RolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
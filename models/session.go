@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is a server-side record of one issued refresh token chain.
+// Sessions live in redis and are not migrated to postgres.
+type Session struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"-"`
+	RefreshID  string    `json:"-"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entitlements are the paid features, plans grant them (see config.Plans).
+const (
+	EntitlementUnlimitedLikes = "unlimited_likes"
+	EntitlementSeeLikes       = "see_likes"
+	EntitlementRewind         = "rewind"
+	EntitlementBoost          = "boost"
+)
+
+// SubscriptionProviderAdmin marks plans granted by admins without payment.
+const SubscriptionProviderAdmin = "admin"
+
+// Subscription gives the user the plan until ExpiresAt, renewals move ExpiresAt.
+// Canceled subscriptions end at once.
+type Subscription struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index" json:"user_id"`
+	Plan     string `gorm:"not null" json:"plan"`
+	Provider string `gorm:"not null;uniqueIndex:idx_subscriptions_external" json:"provider"`
+	// ExternalID is the subscription id at the payment provider, nil for admin grants
+	ExternalID  *string    `gorm:"uniqueIndex:idx_subscriptions_external" json:"external_id,omitempty"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+	CanceledAt  *time.Time `json:"canceled_at,omitempty"`
+	GrantedByID *uint      `json:"granted_by_id,omitempty"`
+	// RevokedAt is set when an admin revoked the subscription or replaced it with
+	// a grant, webhooks of the provider never reactivate it.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (s *Subscription) IsActive(now time.Time) bool {
+	return s.CanceledAt == nil && s.ExpiresAt.After(now)
+}
+
+const (
+	PaymentEventSubscriptionActive   = "subscription.active"
+	PaymentEventSubscriptionCanceled = "subscription.canceled"
+)
+
+// PaymentEvent is a processed webhook event, it keeps retried webhooks from
+// being applied twice.
+type PaymentEvent struct {
+	gorm.Model
+	Provider       string    `gorm:"not null;uniqueIndex:idx_payment_events_event" json:"provider"`
+	EventID        string    `gorm:"not null;uniqueIndex:idx_payment_events_event" json:"event_id"`
+	Type           string    `gorm:"not null" json:"type"`
+	UserID         uint      `gorm:"not null;index" json:"user_id"`
+	Plan           string    `json:"plan"`
+	SubscriptionID string    `gorm:"not null" json:"subscription_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
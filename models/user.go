@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/ilyaDyb/go_rest_api/geo"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -10,24 +11,71 @@ import (
 type User struct {
 	gorm.Model
 	// Id             uint      `json:"id" gorm:"primary_key"`
-	Username         string    `json:"username" gorm:"unique"`
-	Email            string    `json:"email"`
-	Password         string    `json:"-"`
-	Firstname        string    `json:"firstname"`
-	Lastname         string    `json:"lastname"`
-	Sex              string    `json:"sex"`
-	Age              uint8     `json:"age"`
-	Country          string    `json:"country"`
-	City             string    `json:"city"`
-	Lat              float32   `json:"lat"`
-	Lon              float32   `json:"lon"`
-	Role             string    `json:"role"`
-	Bio              string    `json:"bio"`
-	Hobbies          string    `json:"hobbies"`
-	Photo            []Photo   `json:"photo" gorm:"foreignKey:UserID"`
-	RestrictionEnd   time.Time `json:"restriction_end"`
-	IsActive         bool      `json:"is_active" gorm:"default:false"`
-	ConfirmationHash string    `json:"-"`
+	Username  string  `json:"username" gorm:"unique"`
+	Email     string  `json:"email"`
+	Password  string  `json:"-"`
+	Firstname string  `json:"firstname"`
+	Lastname  string  `json:"lastname"`
+	Sex       string  `json:"sex"`
+	Age       uint8   `json:"age"`
+	Country   string  `json:"country"`
+	City      string  `json:"city"`
+	Lat       float32 `json:"lat"`
+	Lon       float32 `json:"lon"`
+	// Geohash follows Lat/Lon, see BeforeSave
+	Geohash string `json:"-" gorm:"size:12;index"`
+	// Timezone is an IANA name, daily quotas reset at midnight in it, empty is UTC
+	Timezone string `json:"timezone"`
+	// TimezoneChangedAt limits how often the timezone changes, see config.TimezoneChangeInterval
+	TimezoneChangedAt *time.Time `json:"-"`
+	Role              string     `json:"role"`
+	Bio               string     `json:"bio"`
+	Hobbies           string     `json:"hobbies"`
+	Photo             []Photo    `json:"photo" gorm:"foreignKey:UserID"`
+	IsActive          bool       `json:"is_active" gorm:"default:false"`
+	// deactivated profiles are hidden from other users, the data is kept
+	IsDeactivated       bool       `json:"is_deactivated" gorm:"default:false"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	// HidePresence hides online status and last seen time from other users
+	HidePresence bool `json:"hide_presence" gorm:"default:false"`
+	// LastActiveAt is updated on login and token refresh, the feed prefers active users
+	LastActiveAt *time.Time `json:"-" gorm:"index"`
+	// BoostedUntil puts the user at the top of other users' feeds
+	BoostedUntil *time.Time `json:"-"`
+	// SuperlikedMe is set on feed candidates who superliked the viewer
+	SuperlikedMe     bool   `json:"superliked_me,omitempty" gorm:"-"`
+	ConfirmationHash string `json:"-"`
+	// nil for accounts created before confirmation links started to expire
+	ConfirmationExpiresAt *time.Time `json:"-"`
+	PendingEmail          string     `json:"-"`
+	EmailChangeHash       string     `json:"-"`
+	EmailChangeExpiresAt  time.Time  `json:"-"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled" gorm:"default:false"`
+	TOTPSecret            string     `json:"-"`
+	TOTPLastStep          int64      `json:"-"`
+}
+
+// BeforeSave keeps Geohash in sync with the coordinates, PostGIS location is
+// synced by a trigger in the database.
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	if geo.HasLocation(float64(u.Lat), float64(u.Lon)) {
+		u.Geohash = geo.EncodeGeohash(float64(u.Lat), float64(u.Lon), geo.MaxGeohashPrecision)
+	} else {
+		u.Geohash = ""
+	}
+	return nil
+}
+
+// Location is the user's timezone, UTC when it's not set or unknown.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 func (u *User) HashPassword(password string) error {
@@ -50,6 +98,40 @@ type Photo struct {
 	IsPreview bool   `json:"is_preview"`
 }
 
+// RecoveryCode is a one-time replacement for a TOTP code, only its hash is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `json:"user_id" gorm:"index"`
+	CodeHash string `json:"-"`
+	Used     bool   `json:"used" gorm:"default:false"`
+}
+
+// LinkedIdentity connects user with an account of social login provider.
+type LinkedIdentity struct {
+	gorm.Model
+	UserID   uint   `json:"user_id" gorm:"index"`
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_provider_subject"`
+	Subject  string `json:"-" gorm:"uniqueIndex:idx_provider_subject"`
+	Email    string `json:"email"`
+}
+
+func (LinkedIdentity) TableName() string {
+	return "linked_identities"
+}
+
+const (
+	InteractionLike      = "like"
+	InteractionDislike   = "dislike"
+	InteractionSuperlike = "superlike"
+)
+
+// LikeInteractions are the interactions which make a match when both users like each other.
+var LikeInteractions = []string{InteractionLike, InteractionSuperlike}
+
+func IsLikeInteraction(interactionType string) bool {
+	return interactionType == InteractionLike || interactionType == InteractionSuperlike
+}
+
 type UserInteraction struct {
 	gorm.Model
 	UserID          uint   `json:"user_id"`
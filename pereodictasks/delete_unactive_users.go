@@ -36,9 +36,14 @@ func StartPereodicTasks() error {
 
 func deleteInactiveUsers() error {
 	log.Println("Running deleteInactiveUsers task")
-	criticalTime := time.Now().Add(-24 * time.Hour)
+	now := time.Now()
+	// accounts registered before confirmation links got an expiry keep the old 24h rule
+	criticalTime := now.Add(-24 * time.Hour)
 	var unActiveUsers []models.User
-	if err := config.DB.Model(&models.User{}).Where("is_active = ? AND created_at < ?", false, criticalTime).Find(&unActiveUsers).Error; err != nil {
+	if err := config.DB.Model(&models.User{}).Where(
+		"is_active = ? AND ((confirmation_expires_at IS NOT NULL AND confirmation_expires_at < ?) OR (confirmation_expires_at IS NULL AND created_at < ?))",
+		false, now, criticalTime,
+	).Find(&unActiveUsers).Error; err != nil {
 		return err
 	}
 	tx := config.DB.Begin()
@@ -0,0 +1,79 @@
+// Package ranking orders profile feed candidates for a viewer.
+package ranking
+
+import (
+	"sort"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+)
+
+// Scorer rates one aspect of the candidate for the viewer, scores are in [0, 1].
+type Scorer interface {
+	Name() string
+	Score(viewer *models.User, candidate *models.User) float64
+}
+
+// Ranker orders candidates for the viewer, the best first.
+type Ranker interface {
+	Rank(viewer *models.User, candidates []models.User) []models.User
+}
+
+type weightedScorer struct {
+	scorer Scorer
+	weight float64
+}
+
+// WeightedRanker sorts candidates by the weighted sum of scorers.
+type WeightedRanker struct {
+	scorers []weightedScorer
+}
+
+// NewWeightedRanker takes weights by scorer name, scorers without weight are skipped.
+func NewWeightedRanker(weights map[string]float64, scorers ...Scorer) *WeightedRanker {
+	r := &WeightedRanker{}
+	for _, s := range scorers {
+		if w := weights[s.Name()]; w > 0 {
+			r.scorers = append(r.scorers, weightedScorer{scorer: s, weight: w})
+		}
+	}
+	return r
+}
+
+// NewDefaultRanker uses all scorers with weights from config.RankingWeights.
+func NewDefaultRanker() *WeightedRanker {
+	return NewWeightedRanker(config.RankingWeights,
+		DistanceScorer{MaxKm: 50},
+		HobbiesScorer{},
+		AgeScorer{Range: 10},
+		ActivityScorer{},
+		CompletenessScorer{},
+		SuperlikeScorer{},
+		BoostScorer{},
+	)
+}
+
+// Score is the weighted sum of all scorers for the candidate.
+func (r *WeightedRanker) Score(viewer *models.User, candidate *models.User) float64 {
+	total := 0.0
+	for _, ws := range r.scorers {
+		total += ws.weight * ws.scorer.Score(viewer, candidate)
+	}
+	return total
+}
+
+// Rank sorts candidates in place, equal scores keep the order by id so pages are stable.
+func (r *WeightedRanker) Rank(viewer *models.User, candidates []models.User) []models.User {
+	scores := make(map[uint]float64, len(candidates))
+	for i := range candidates {
+		scores[candidates[i].ID] = r.Score(viewer, &candidates[i])
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := scores[candidates[i].ID], scores[candidates[j].ID]
+		if si != sj {
+			return si > sj
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates
+}
@@ -0,0 +1,104 @@
+package ranking
+
+import (
+	"testing"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedScorer scores candidates from a table by id.
+type fixedScorer struct {
+	name   string
+	scores map[uint]float64
+}
+
+func (s fixedScorer) Name() string { return s.name }
+
+func (s fixedScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	return s.scores[candidate.ID]
+}
+
+func userWithID(id uint) models.User {
+	var user models.User
+	user.ID = id
+	return user
+}
+
+func candidateIDs(candidates []models.User) []uint {
+	ids := make([]uint, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ID
+	}
+	return ids
+}
+
+func TestWeightedRankerScore(t *testing.T) {
+	a := fixedScorer{name: "a", scores: map[uint]float64{1: 1, 2: 0.5}}
+	b := fixedScorer{name: "b", scores: map[uint]float64{1: 0, 2: 1}}
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		want    map[uint]float64
+	}{
+		{"equal weights", map[string]float64{"a": 1, "b": 1}, map[uint]float64{1: 1, 2: 1.5}},
+		{"weights scale scores", map[string]float64{"a": 2, "b": 0.5}, map[uint]float64{1: 2, 2: 1.5}},
+		{"zero weight skips scorer", map[string]float64{"a": 1, "b": 0}, map[uint]float64{1: 1, 2: 0.5}},
+		{"missing weight skips scorer", map[string]float64{"b": 1}, map[uint]float64{1: 0, 2: 1}},
+		{"no weights", map[string]float64{}, map[uint]float64{1: 0, 2: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranker := NewWeightedRanker(tt.weights, a, b)
+			for id, want := range tt.want {
+				candidate := userWithID(id)
+				assert.InDelta(t, want, ranker.Score(&models.User{}, &candidate), 1e-9)
+			}
+		})
+	}
+}
+
+func TestWeightedRankerRank(t *testing.T) {
+	scorer := fixedScorer{name: "a", scores: map[uint]float64{1: 0.2, 2: 0.9, 3: 0.5, 4: 0.5}}
+	tests := []struct {
+		name       string
+		weights    map[string]float64
+		candidates []uint
+		want       []uint
+	}{
+		{"best first", map[string]float64{"a": 1}, []uint{1, 2, 3}, []uint{2, 3, 1}},
+		{"ties are ordered by id", map[string]float64{"a": 1}, []uint{4, 1, 3, 2}, []uint{2, 3, 4, 1}},
+		{"without scorers the order is by id", map[string]float64{}, []uint{3, 1, 2}, []uint{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := make([]models.User, len(tt.candidates))
+			for i, id := range tt.candidates {
+				candidates[i] = userWithID(id)
+			}
+			ranked := NewWeightedRanker(tt.weights, scorer).Rank(&models.User{}, candidates)
+			assert.Equal(t, tt.want, candidateIDs(ranked))
+		})
+	}
+}
+
+func TestDefaultRankerScoresAreNormalised(t *testing.T) {
+	// every scorer is in [0, 1], so a perfect candidate scores the sum of weights
+	weights := map[string]float64{
+		"distance": 1, "hobbies": 1, "age": 1, "activity": 1, "completeness": 1, "superlike": 1, "boost": 1,
+	}
+	ranker := NewWeightedRanker(weights,
+		DistanceScorer{MaxKm: 50}, HobbiesScorer{}, AgeScorer{Range: 10}, ActivityScorer{},
+		CompletenessScorer{}, SuperlikeScorer{}, BoostScorer{},
+	)
+	viewer := models.User{Lat: 55, Lon: 37, Hobbies: "chess", Age: 25}
+	for _, candidate := range []models.User{
+		{},
+		{Lat: -33, Lon: 151, Hobbies: "surfing", Age: 99},
+		{Lat: 55, Lon: 37, Hobbies: "chess", Age: 25},
+	} {
+		score := ranker.Score(&viewer, &candidate)
+		assert.GreaterOrEqual(t, score, 0.0)
+		assert.LessOrEqual(t, score, float64(len(weights)))
+	}
+}
@@ -0,0 +1,145 @@
+package ranking
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/geo"
+	"github.com/ilyaDyb/go_rest_api/models"
+)
+
+// DistanceScorer prefers closer candidates, the score falls to 0 at MaxKm.
+// Without coordinates it falls back to comparing cities.
+type DistanceScorer struct {
+	MaxKm float64
+}
+
+func (DistanceScorer) Name() string { return "distance" }
+
+func (s DistanceScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	if !geo.HasLocation(float64(viewer.Lat), float64(viewer.Lon)) || !geo.HasLocation(float64(candidate.Lat), float64(candidate.Lon)) {
+		if viewer.City != "" && strings.EqualFold(viewer.City, candidate.City) {
+			return 1
+		}
+		return 0
+	}
+	distance := geo.Haversine(
+		float64(viewer.Lat), float64(viewer.Lon), float64(candidate.Lat), float64(candidate.Lon),
+	)
+	return math.Max(0, 1-distance/s.MaxKm)
+}
+
+// HobbiesScorer is the share of common hobbies (Jaccard index).
+type HobbiesScorer struct{}
+
+func (HobbiesScorer) Name() string { return "hobbies" }
+
+func (HobbiesScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	own, other := hobbySet(viewer.Hobbies), hobbySet(candidate.Hobbies)
+	if len(own) == 0 || len(other) == 0 {
+		return 0
+	}
+	common := 0
+	for hobby := range own {
+		if other[hobby] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(own)+len(other)-common)
+}
+
+func hobbySet(hobbies string) map[string]bool {
+	set := make(map[string]bool)
+	for _, hobby := range strings.Split(hobbies, ",") {
+		if hobby = strings.ToLower(strings.TrimSpace(hobby)); hobby != "" {
+			set[hobby] = true
+		}
+	}
+	return set
+}
+
+// AgeScorer prefers candidates of similar age, the score falls to 0 at Range years.
+type AgeScorer struct {
+	Range float64
+}
+
+func (AgeScorer) Name() string { return "age" }
+
+func (s AgeScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	if viewer.Age == 0 || candidate.Age == 0 {
+		return 0
+	}
+	diff := math.Abs(float64(viewer.Age) - float64(candidate.Age))
+	return math.Max(0, 1-diff/s.Range)
+}
+
+// activityHalfLife is the time after which the activity score halves.
+const activityHalfLife = 72 * time.Hour
+
+// ActivityScorer prefers recently active candidates.
+type ActivityScorer struct {
+	// Now is used in place of time.Now when set
+	Now func() time.Time
+}
+
+func (ActivityScorer) Name() string { return "activity" }
+
+func (s ActivityScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	if candidate.LastActiveAt == nil {
+		return 0
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	idle := math.Max(0, now.Sub(*candidate.LastActiveAt).Hours())
+	return math.Pow(0.5, idle/activityHalfLife.Hours())
+}
+
+// CompletenessScorer is the share of filled profile fields.
+type CompletenessScorer struct{}
+
+func (CompletenessScorer) Name() string { return "completeness" }
+
+func (CompletenessScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	filled := []bool{
+		len(candidate.Photo) > 0,
+		candidate.Bio != "",
+		candidate.Hobbies != "",
+		candidate.City != "",
+		candidate.Firstname != "",
+		candidate.Age != 0,
+	}
+	count := 0
+	for _, ok := range filled {
+		if ok {
+			count++
+		}
+	}
+	return float64(count) / float64(len(filled))
+}
+
+// SuperlikeScorer boosts candidates who superliked the viewer.
+type SuperlikeScorer struct{}
+
+func (SuperlikeScorer) Name() string { return "superlike" }
+
+func (SuperlikeScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	if candidate.SuperlikedMe {
+		return 1
+	}
+	return 0
+}
+
+// BoostScorer puts boosted candidates first.
+type BoostScorer struct{}
+
+func (BoostScorer) Name() string { return "boost" }
+
+func (BoostScorer) Score(viewer *models.User, candidate *models.User) float64 {
+	if candidate.BoostedUntil != nil && candidate.BoostedUntil.After(time.Now()) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
+
+func TestDistanceScorer(t *testing.T) {
+	scorer := DistanceScorer{MaxKm: 50}
+	tests := []struct {
+		name      string
+		viewer    models.User
+		candidate models.User
+		want      float64
+	}{
+		{"same point", models.User{Lat: 55, Lon: 37}, models.User{Lat: 55, Lon: 37}, 1},
+		// 0.2 degrees of latitude is about 22.24 km
+		{"within range", models.User{Lat: 55, Lon: 37}, models.User{Lat: 55.2, Lon: 37}, 1 - 22.24/50},
+		{"out of range", models.User{Lat: 55, Lon: 37}, models.User{Lat: 59.9, Lon: 30.3}, 0},
+		{"same city without location", models.User{City: "Moscow"}, models.User{City: "moscow", Lat: 55, Lon: 37}, 1},
+		{"other city without location", models.User{City: "Moscow"}, models.User{City: "Kazan"}, 0},
+		{"no city and location", models.User{}, models.User{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, scorer.Score(&tt.viewer, &tt.candidate), 0.001)
+		})
+	}
+}
+
+func TestHobbiesScorer(t *testing.T) {
+	tests := []struct {
+		name      string
+		viewer    string
+		candidate string
+		want      float64
+	}{
+		{"same hobbies", "chess,music", "music,chess", 1},
+		{"case and spaces are ignored", "Chess, Music", "chess,music ", 1},
+		{"one of three common", "chess,music", "music,hiking", 1.0 / 3},
+		{"nothing common", "chess", "hiking", 0},
+		{"viewer without hobbies", "", "chess", 0},
+		{"candidate without hobbies", "chess", " , ", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viewer, candidate := models.User{Hobbies: tt.viewer}, models.User{Hobbies: tt.candidate}
+			assert.InDelta(t, tt.want, HobbiesScorer{}.Score(&viewer, &candidate), 1e-9)
+		})
+	}
+}
+
+func TestAgeScorer(t *testing.T) {
+	scorer := AgeScorer{Range: 10}
+	tests := []struct {
+		name      string
+		viewer    uint8
+		candidate uint8
+		want      float64
+	}{
+		{"same age", 25, 25, 1},
+		{"younger", 25, 20, 0.5},
+		{"older", 25, 30, 0.5},
+		{"out of range", 25, 40, 0},
+		{"unknown age", 0, 25, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viewer, candidate := models.User{Age: tt.viewer}, models.User{Age: tt.candidate}
+			assert.InDelta(t, tt.want, scorer.Score(&viewer, &candidate), 1e-9)
+		})
+	}
+}
+
+func TestActivityScorer(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	scorer := ActivityScorer{Now: func() time.Time { return now }}
+	tests := []struct {
+		name         string
+		lastActiveAt *time.Time
+		want         float64
+	}{
+		{"active now", ptrTime(now), 1},
+		{"one half-life ago", ptrTime(now.Add(-activityHalfLife)), 0.5},
+		{"two half-lives ago", ptrTime(now.Add(-2 * activityHalfLife)), 0.25},
+		{"clock skew in the future", ptrTime(now.Add(time.Hour)), 1},
+		{"never active", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidate := models.User{LastActiveAt: tt.lastActiveAt}
+			assert.InDelta(t, tt.want, scorer.Score(&models.User{}, &candidate), 1e-9)
+		})
+	}
+}
+
+func TestCompletenessScorer(t *testing.T) {
+	full := models.User{
+		Photo:     []models.Photo{{}},
+		Bio:       "bio",
+		Hobbies:   "chess",
+		City:      "Moscow",
+		Firstname: "Ann",
+		Age:       25,
+	}
+	tests := []struct {
+		name      string
+		candidate models.User
+		want      float64
+	}{
+		{"full profile", full, 1},
+		{"half filled", models.User{Bio: "bio", City: "Moscow", Age: 25}, 0.5},
+		{"empty profile", models.User{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, CompletenessScorer{}.Score(&models.User{}, &tt.candidate), 1e-9)
+		})
+	}
+}
+
+func TestSuperlikeAndBoostScorers(t *testing.T) {
+	tests := []struct {
+		name      string
+		scorer    Scorer
+		candidate models.User
+		want      float64
+	}{
+		{"superliked the viewer", SuperlikeScorer{}, models.User{SuperlikedMe: true}, 1},
+		{"didn't superlike", SuperlikeScorer{}, models.User{}, 0},
+		{"boosted", BoostScorer{}, models.User{BoostedUntil: ptrTime(time.Now().Add(time.Hour))}, 1},
+		{"boost expired", BoostScorer{}, models.User{BoostedUntil: ptrTime(time.Now().Add(-time.Hour))}, 0},
+		{"never boosted", BoostScorer{}, models.User{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.scorer.Score(&models.User{}, &tt.candidate))
+		})
+	}
+}
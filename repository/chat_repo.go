@@ -1,24 +1,47 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/ilyaDyb/go_rest_api/utils"
 )
 
+// MessagePage is a keyset page of chat history: messages older than BeforeID or
+// newer than AfterID, without both of them the latest messages are returned.
+type MessagePage struct {
+	BeforeID uint
+	AfterID  uint
+	Limit    int
+}
+
 type ChatRepo interface {
 	//for admin controllers
 	GetAllChats() (*[]models.Chat, error)
 
 	//for other controllers
-	CreateChat(chat *models.Chat) error 
+	CreateChat(chat *models.Chat) error
 	CreateMessage(message *models.Message) error
 
 	GetChatByUsernames(username1, username2 string) (*models.Chat, error)
-	GetMessagesByIDChat(chatID uint) (*[]models.Message, error)
+	GetChatByID(chatID uint) (*models.Chat, error)
+	GetChatPartnerIDs(userID uint) ([]uint, error)
+	CloseChat(userID uint, otherID uint, closedAt time.Time) ([]models.Chat, error)
+	GetMessagesByIDChat(chatID uint, viewerID uint, page MessagePage) (*[]models.Message, bool, error)
+	GetMessagesForModeration(chatID uint) (*[]models.Message, error)
+	GetMessageByID(messageID uint) (*models.Message, error)
+	GetMessagesByIDs(messageIDs []uint) ([]models.Message, error)
+	GetAttachmentByID(attachmentID uint) (*models.Attachment, error)
+	EditMessage(message *models.Message, edit *models.MessageEdit) error
+	DeleteMessageForEveryone(message *models.Message) error
+	HideMessage(messageID uint, userID uint) error
 	GetUserChats(userID uint) (*[]utils.ChatsListResponse, error)
 	GetLastMessageByChatID(chatID uint) (*models.Message, error)
-	
-	
+	GetUserMessages(userID uint) (*[]models.Message, error)
+	GetMessageByClientMsgID(senderID uint, clientMsgID string) (*models.Message, error)
+	GetUserMessagesAfter(userID uint, afterID uint, overlap time.Duration, limit int) (*[]models.Message, error)
+	MarkMessagesRead(chatID uint, readerID uint, upToID uint, readAt time.Time) (int64, error)
+
 	// GetChatsForSpecUser(userID uint) ([]struct {
 	// 	User              models.User
 	// 	LastMessage       string
@@ -42,4 +65,4 @@ type ChatRepo interface {
 
 // func (r *chatRepo) GetChat(user1ID, user2ID uint) (*models.Chat, error) {
 // 	return r.GetChat(user1ID, user2ID)
-// }
\ No newline at end of file
+// }
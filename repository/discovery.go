@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"gorm.io/gorm"
+)
+
+// candidateGenders falls back to models.DefaultGenders for users without saved preferences.
+var candidateGenders = fmt.Sprintf(
+	"COALESCE(dp.genders, CASE users.sex WHEN '%s' THEN '%s' WHEN '%s' THEN '%s' ELSE '%s' END)",
+	models.SexMale, genderList(models.DefaultGenders(models.SexMale)),
+	models.SexFemale, genderList(models.DefaultGenders(models.SexFemale)),
+	genderList(models.DefaultGenders(models.SexNonBinary)),
+)
+
+// genderList encodes genders the way the json serializer stores DiscoveryPreferences.Genders.
+func genderList(genders []string) string {
+	data, _ := json.Marshal(genders)
+	return string(data)
+}
+
+// genderPattern matches sex as a whole element of the stored genders list, the
+// LIKE wildcards are escaped so an unexpected sex can't match every list.
+func genderPattern(sex string) string {
+	element, _ := json.Marshal(sex)
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(string(element)) + "%"
+}
+
+// discoveryScope keeps the candidates whose preferences and the user's preferences
+// match each other: gender, age, distance and photos are checked in both directions.
+func discoveryScope(user *models.User, prefs *models.DiscoveryPreferences) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		lat, lon := float64(user.Lat), float64(user.Lon)
+		db = db.Select("users.*").
+			Joins("LEFT JOIN discovery_preferences dp ON dp.user_id = users.id AND dp.deleted_at IS NULL").
+			// the user's preferences
+			Where("users.sex IN ?", prefs.Genders).
+			Where("users.age BETWEEN ? AND ?", prefs.MinAge, prefs.MaxAge).
+			// the candidate's preferences
+			Where(candidateGenders+` LIKE ? ESCAPE '\'`, genderPattern(user.Sex)).
+			Where("? BETWEEN COALESCE(dp.min_age, ?) AND COALESCE(dp.max_age, ?)", user.Age, models.MinDiscoveryAge, models.MaxDiscoveryAge)
+		db = config.Spatial.NearByColumn(db, lat, lon, "dp.max_distance_km")
+
+		if prefs.MaxDistanceKm > 0 {
+			db = config.Spatial.Near(db, lat, lon, float64(prefs.MaxDistanceKm))
+		}
+		if prefs.PhotosOnly {
+			db = db.Where("EXISTS (SELECT 1 FROM photos WHERE photos.user_id = users.id AND photos.deleted_at IS NULL)")
+		}
+		if len(user.Photo) == 0 {
+			db = db.Where("COALESCE(dp.photos_only, false) = false")
+		}
+		return db
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"gorm.io/gorm"
+)
+
+// snippetRadius is the number of characters kept around the match.
+const snippetRadius = 40
+
+// LikeMessageSearcher matches the whole query as a substring, it needs no index
+// and works on any database.
+type LikeMessageSearcher struct {
+	db *gorm.DB
+}
+
+func NewLikeMessageSearcher(db *gorm.DB) *LikeMessageSearcher {
+	return &LikeMessageSearcher{db: db}
+}
+
+func (s *LikeMessageSearcher) SearchMessages(userID uint, query string, limit int) (*[]utils.MessageSearchResponse, error) {
+	var rows []struct {
+		utils.MessageSearchResponse
+		Content string
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	pattern := "%" + escaper.Replace(strings.ToLower(query)) + "%"
+	err := searchableMessages(s.db, userID).
+		Select("messages.chat_id, messages.id AS message_id, messages.sender_id, messages.created_at, messages.content").
+		Where(`LOWER(messages.content) LIKE ? ESCAPE '\'`, pattern).
+		Order("messages.created_at DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]utils.MessageSearchResponse, len(rows))
+	for i, row := range rows {
+		results[i] = row.MessageSearchResponse
+		results[i].Snippet = likeSnippet(row.Content, query)
+	}
+	return &results, nil
+}
+
+// likeSnippet cuts the content around the first match and marks the match, the
+// content is HTML-escaped.
+func likeSnippet(content, query string) string {
+	content = strings.NewReplacer(rawSnippetStart, "", rawSnippetStop, "").Replace(content)
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	needle := []rune(strings.ToLower(query))
+	start := -1
+	for i := 0; i+len(needle) <= len(lower); i++ {
+		if string(lower[i:i+len(needle)]) == string(needle) {
+			start = i
+			break
+		}
+	}
+	if start < 0 || len(lower) != len(runes) {
+		return escapeSnippet(content)
+	}
+	end := start + len(needle)
+	from, to := max(start-snippetRadius, 0), min(end+snippetRadius, len(runes))
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(string(runes[from:start]))
+	b.WriteString(rawSnippetStart + string(runes[start:end]) + rawSnippetStop)
+	b.WriteString(string(runes[end:to]))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return escapeSnippet(b.String())
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLikeSnippet(t *testing.T) {
+	long := strings.Repeat("a", 50)
+	tests := []struct {
+		name    string
+		content string
+		query   string
+		want    string
+	}{
+		{"marks the match", "see you Tomorrow then", "tomorrow", "see you <mark>Tomorrow</mark> then"},
+		{"cuts long content", long + " hello " + long, "hello", "…" + long[:39] + " <mark>hello</mark> " + long[:39] + "…"},
+		{"escapes the content", `<img src=x onerror=alert(1)> hi`, "hi", "&lt;img src=x onerror=alert(1)&gt; <mark>hi</mark>"},
+		{"escapes the match", "say <b>", "<b>", "say <mark>&lt;b&gt;</mark>"},
+		{"escapes content without a match", "<script>", "nothing", "&lt;script&gt;"},
+		{"drops forged markers", "\x01<i>\x02 x", "x", "&lt;i&gt; <mark>x</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, likeSnippet(tt.content, tt.query))
+		})
+	}
+}
+
+func TestLikeMessageSearcher(t *testing.T) {
+	db := config.DB
+	alice := models.User{Username: "search_alice", Email: "search_alice@example.com", IsActive: true}
+	bob := models.User{Username: "search_bob", Email: "search_bob@example.com", IsActive: true}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+
+	chat := models.Chat{User1ID: alice.ID, User2ID: bob.ID}
+	closed := models.Chat{User1ID: alice.ID, User2ID: bob.ID, ClosedAt: ptrTime(time.Now())}
+	require.NoError(t, db.Create(&chat).Error)
+	require.NoError(t, db.Create(&closed).Error)
+
+	send := func(chatID uint, content string) models.Message {
+		message := models.Message{ChatID: chatID, SenderID: bob.ID, ReceiverID: alice.ID, Content: content}
+		require.NoError(t, db.Create(&message).Error)
+		return message
+	}
+	found := send(chat.ID, `<script>alert("x")</script> Zebra`)
+	hidden := send(chat.ID, "zebra hidden")
+	require.NoError(t, db.Create(&models.MessageHide{MessageID: hidden.ID, UserID: alice.ID}).Error)
+	tombstone := send(chat.ID, "zebra deleted")
+	require.NoError(t, db.Model(&tombstone).Update("deleted_for_everyone_at", time.Now()).Error)
+	send(closed.ID, "zebra in closed chat")
+	send(chat.ID, "unrelated")
+
+	results, err := NewLikeMessageSearcher(db).SearchMessages(alice.ID, "zebra", 10)
+	require.NoError(t, err)
+	require.Len(t, *results, 1)
+	result := (*results)[0]
+	assert.Equal(t, found.ID, result.MessageID)
+	assert.Equal(t, chat.ID, result.ChatID)
+	assert.Equal(t, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>Zebra</mark>", result.Snippet)
+
+	// the search pattern is matched literally
+	results, err = NewLikeMessageSearcher(db).SearchMessages(alice.ID, "%", 10)
+	require.NoError(t, err)
+	assert.Empty(t, *results)
+
+	// bob still sees the message alice hid
+	results, err = NewLikeMessageSearcher(db).SearchMessages(bob.ID, "zebra", 10)
+	require.NoError(t, err)
+	assert.Len(t, *results, 2)
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"html"
+	"strings"
+
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"gorm.io/gorm"
+)
+
+// Highlighted terms in search snippets are wrapped with these markers, the rest
+// of the snippet is HTML-escaped.
+const (
+	SnippetStart = "<mark>"
+	SnippetStop  = "</mark>"
+)
+
+// Control characters stand in for the markers until the snippet is escaped, they
+// are stripped from the content so a message can't forge a highlight.
+const (
+	rawSnippetStart = "\x01"
+	rawSnippetStop  = "\x02"
+)
+
+// highlightReplacer escapes the snippet and turns the raw markers into tags.
+var highlightReplacer = strings.NewReplacer(rawSnippetStart, SnippetStart, rawSnippetStop, SnippetStop)
+
+// escapeSnippet makes a snippet with raw markers safe to render as HTML.
+func escapeSnippet(snippet string) string {
+	return highlightReplacer.Replace(html.EscapeString(snippet))
+}
+
+// MessageSearcher searches message content in the chats of the user. Messages
+// deleted for everyone or hidden by the user are never returned.
+type MessageSearcher interface {
+	SearchMessages(userID uint, query string, limit int) (*[]utils.MessageSearchResponse, error)
+}
+
+// NewMessageSearcher picks the full-text implementation for postgres and the
+// LIKE based one for other databases (sqlite in tests).
+func NewMessageSearcher(db *gorm.DB) MessageSearcher {
+	if db.Dialector.Name() == "postgres" {
+		return NewPostgresMessageSearcher(db)
+	}
+	return NewLikeMessageSearcher(db)
+}
+
+// searchableMessages limits the search to messages the user can see.
+func searchableMessages(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Table("messages").
+		Joins("JOIN chats ON chats.id = messages.chat_id AND chats.deleted_at IS NULL AND chats.closed_at IS NULL").
+		Where("(messages.sender_id = ? OR messages.receiver_id = ?)", userID, userID).
+		Where("messages.deleted_at IS NULL AND messages.deleted_for_everyone_at IS NULL").
+		Where("messages.id NOT IN (SELECT message_id FROM message_hides WHERE user_id = ? AND deleted_at IS NULL)", userID)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"github.com/ilyaDyb/go_rest_api/models"
+)
+
+type ModerationRepo interface {
+	CreateBlock(block *models.Block) error
+	DeleteBlock(blockerID uint, blockedID uint) error
+	GetBlocks(blockerID uint) ([]models.Block, error)
+	IsBlocked(userID uint, otherID uint) (bool, error)
+
+	CreateReport(report *models.Report) error
+	GetReports(status string, limit int, offset int) ([]models.Report, error)
+	GetReportsCount(status string) (int64, error)
+	GetReportByID(reportID uint) (*models.Report, error)
+	UpdateReport(report *models.Report) error
+}
@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/ilyaDyb/go_rest_api/config"
 	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/ilyaDyb/go_rest_api/utils"
@@ -15,7 +18,6 @@ func NewPostgresChatRepo(db *gorm.DB) *PostgresChatRepo {
 	return &PostgresChatRepo{db: db}
 }
 
-
 func (repo *PostgresChatRepo) CreateChat(user *models.Chat) error {
 	return repo.db.Create(user).Error
 }
@@ -27,9 +29,9 @@ func (repo *PostgresChatRepo) CreateMessage(message *models.Message) error {
 func (repo *PostgresChatRepo) GetAllChats() (*[]models.Chat, error) {
 	var chats []models.Chat
 	if err := repo.db.Model(models.Chat{}).
-	Preload("User1.Photo", "is_preview = ?", true).
-	Preload("User2.Photo", "is_preview = ?", true).
-	Find(&chats).Error; err != nil {
+		Preload("User1.Photo", "is_preview = ?", true).
+		Preload("User2.Photo", "is_preview = ?", true).
+		Find(&chats).Error; err != nil {
 		return nil, err
 	}
 	return &chats, nil
@@ -41,6 +43,7 @@ func (repo *PostgresChatRepo) GetChatByUsernames(username1, username2 string) (*
 		Joins("JOIN users u1 ON u1.id = chats.user1_id").
 		Joins("JOIN users u2 ON u2.id = chats.user2_id").
 		Where("(u1.username = ? AND u2.username = ?) OR (u1.username = ? AND u2.username = ?)", username1, username2, username2, username1).
+		Where("chats.closed_at IS NULL").
 		Preload("User1.Photo", "is_preview = ?", true).
 		Preload("User2.Photo", "is_preview = ?", true).
 		First(&chat).Error
@@ -50,15 +53,125 @@ func (repo *PostgresChatRepo) GetChatByUsernames(username1, username2 string) (*
 	return &chat, nil
 }
 
+// GetChatByID returns only open chats, closed ones are not accessible to the members.
+func (repo *PostgresChatRepo) GetChatByID(chatID uint) (*models.Chat, error) {
+	var chat models.Chat
+	if err := repo.db.Where("closed_at IS NULL").First(&chat, chatID).Error; err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+func (repo *PostgresChatRepo) GetChatPartnerIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	query := `
+		SELECT CASE WHEN user1_id = ? THEN user2_id ELSE user1_id END FROM chats
+		WHERE (user1_id = ? OR user2_id = ?) AND deleted_at IS NULL AND closed_at IS NULL
+	`
+	err := repo.db.Raw(query, userID, userID, userID).Scan(&ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// hiddenForUser excludes messages the user removed with "delete for me".
+const hiddenForUser = "id NOT IN (SELECT message_id FROM message_hides WHERE user_id = ? AND deleted_at IS NULL)"
 
-func (repo *PostgresChatRepo) GetMessagesByIDChat(chatID uint) (*[]models.Message, error) {
+// GetMessagesByIDChat returns a page of messages as the viewer sees them: without
+// messages hidden by the viewer and with tombstones instead of messages deleted for
+// everyone. Messages are in chronological order, hasMore tells whether there are
+// more messages in the direction of the page.
+func (repo *PostgresChatRepo) GetMessagesByIDChat(chatID uint, viewerID uint, page MessagePage) (*[]models.Message, bool, error) {
 	var messages []models.Message
-	if err := repo.db.Model(&models.Message{}).Where("chat_id = ?", chatID).Find(&messages).Error; err != nil {
+	query := repo.db.Model(&models.Message{}).Preload("Attachments").Where("chat_id = ?", chatID).
+		Where(hiddenForUser, viewerID)
+	// the cursor is the position of the message in the (created_at, id) order,
+	// ids alone don't follow created_at
+	if page.AfterID != 0 {
+		query = query.Where("(created_at, id) > (SELECT created_at, id FROM messages WHERE id = ?)", page.AfterID).
+			Order("created_at, id")
+	} else {
+		if page.BeforeID != 0 {
+			query = query.Where("(created_at, id) < (SELECT created_at, id FROM messages WHERE id = ?)", page.BeforeID)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
+	// one extra row tells whether the next page exists
+	if err := query.Limit(page.Limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > page.Limit
+	if hasMore {
+		messages = messages[:page.Limit]
+	}
+	if page.AfterID == 0 {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	for i := range messages {
+		messages[i].Redact()
+	}
+	return &messages, hasMore, nil
+}
+
+// GetMessagesForModeration returns original content of all messages with edit history.
+func (repo *PostgresChatRepo) GetMessagesForModeration(chatID uint) (*[]models.Message, error) {
+	var messages []models.Message
+	if err := repo.db.Model(&models.Message{}).Preload("Edits").Preload("Attachments").
+		Where("chat_id = ?", chatID).Order("id").Find(&messages).Error; err != nil {
 		return nil, err
 	}
 	return &messages, nil
 }
 
+func (repo *PostgresChatRepo) GetMessageByID(messageID uint) (*models.Message, error) {
+	var message models.Message
+	if err := repo.db.First(&message, messageID).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (repo *PostgresChatRepo) GetMessagesByIDs(messageIDs []uint) ([]models.Message, error) {
+	var messages []models.Message
+	if err := repo.db.Where("id IN ?", messageIDs).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (repo *PostgresChatRepo) GetAttachmentByID(attachmentID uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := repo.db.First(&attachment, attachmentID).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (repo *PostgresChatRepo) EditMessage(message *models.Message, edit *models.MessageEdit) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(edit).Error; err != nil {
+			return err
+		}
+		// only the edited columns are written, Save would overwrite concurrent changes
+		// like read receipts with the loaded values
+		return tx.Model(message).Select("content", "edited_at").Updates(message).Error
+	})
+}
+
+// DeleteMessageForEveryone writes only the tombstone, like EditMessage it must not
+// overwrite concurrent read receipts and edits with the loaded values.
+func (repo *PostgresChatRepo) DeleteMessageForEveryone(message *models.Message) error {
+	return repo.db.Model(message).Select("deleted_for_everyone_at").Updates(message).Error
+}
+
+func (repo *PostgresChatRepo) HideMessage(messageID uint, userID uint) error {
+	hide := models.MessageHide{MessageID: messageID, UserID: userID}
+	return repo.db.Where(hide).FirstOrCreate(&hide).Error
+}
+
 // func (repo *PostgresChatRepo) GetChatsForSpecUser(userID uint) (*[]models.Chat, error) {
 // 	var chats []models.Chat
 // 	if err := repo.db.Model(&models.Chat{}).
@@ -82,17 +195,17 @@ func (repo *PostgresChatRepo) GetMessagesByIDChat(chatID uint) (*[]models.Messag
 // 		IsLastMessageRead bool
 // 		LastMessageTime   time.Time
 // 	}
-	
+
 // 	query := `
-// 		SELECT 
+// 		SELECT
 // 			u.*,
 // 			last_messages.content AS last_message,
 // 			last_messages.is_read AS is_last_message_read,
 // 			last_messages.created_at AS last_message_time
-// 		FROM 
+// 		FROM
 // 			users u
 // 		JOIN (
-// 			SELECT 
+// 			SELECT
 // 				c.id AS chat_id,
 // 				CASE
 // 					WHEN c.user1_id = ? THEN c.user2_id
@@ -101,34 +214,34 @@ func (repo *PostgresChatRepo) GetMessagesByIDChat(chatID uint) (*[]models.Messag
 // 				messages.content,
 // 				messages.is_read,
 // 				messages.created_at AS last_message_time
-// 			FROM 
+// 			FROM
 // 				chats c
 // 			JOIN (
-// 				SELECT 
-// 					m1.chat_id, 
-// 					m1.content, 
-// 					m1.is_read, 
+// 				SELECT
+// 					m1.chat_id,
+// 					m1.content,
+// 					m1.is_read,
 // 					m1.created_at
-// 				FROM 
+// 				FROM
 // 					messages m1
-// 				WHERE 
+// 				WHERE
 // 					(m1.chat_id, m1.created_at) IN (
-// 						SELECT 
-// 							m2.chat_id, 
-// 							MAX(m2.created_at) 
-// 						FROM 
+// 						SELECT
+// 							m2.chat_id,
+// 							MAX(m2.created_at)
+// 						FROM
 // 							messages m2
-// 						GROUP BY 
+// 						GROUP BY
 // 							m2.chat_id
 // 					)
 // 			) messages ON messages.chat_id = c.id
-// 			WHERE 
+// 			WHERE
 // 				c.user1_id = ? OR c.user2_id = ?
 // 		) last_messages ON u.id = last_messages.other_user_id
-// 		ORDER BY 
+// 		ORDER BY
 // 			last_messages.last_message_time DESC
 // 	`
-	
+
 // 	err := repo.db.Raw(query, userID, userID, userID).Scan(&results).Error
 // 	if err != nil {
 // 		return nil, err
@@ -136,29 +249,61 @@ func (repo *PostgresChatRepo) GetMessagesByIDChat(chatID uint) (*[]models.Messag
 // 	return results, nil
 // }
 
+// GetUserChats returns chats of the user, the most recently active first.
 func (repo *PostgresChatRepo) GetUserChats(userID uint) (*[]utils.ChatsListResponse, error) {
 	var results []utils.ChatsListResponse
 
 	query := `
-		SELECT chats.id AS chat_id, users.username, users.firstname, users.lastname, photos.url, messages.content AS last_message,
-		messages.is_read, sender.username AS sender_username FROM chats
+		SELECT chats.id AS chat_id, users.id AS user_id, users.username, users.firstname, users.lastname, users.hide_presence,
+		photos.url, CASE WHEN messages.deleted_for_everyone_at IS NULL THEN messages.content ELSE '' END AS last_message,
+		messages.is_read, sender.username AS sender_username,
+		COALESCE(messages.created_at, chats.created_at) AS last_message_at,
+		(SELECT COUNT(*) FROM messages unread
+			WHERE unread.chat_id = chats.id AND unread.receiver_id = ? AND unread.read_at IS NULL AND unread.deleted_at IS NULL
+		) AS unread_count FROM chats
 		JOIN users ON (users.id = chats.user1_id OR users.id = chats.user2_id)
 		LEFT JOIN photos ON photos.user_id = users.id AND photos.is_preview = true
-		LEFT JOIN messages ON messages.chat_id = chats.id AND messages.created_at = (
-			SELECT MAX(created_at)
-			FROM messages
-			WHERE chat_id = chats.id
-		)
+		LEFT JOIN LATERAL (
+			SELECT * FROM messages last
+			WHERE last.chat_id = chats.id AND last.deleted_at IS NULL
+			ORDER BY last.created_at DESC, last.id DESC
+			LIMIT 1
+		) messages ON true
 		LEFT JOIN users AS sender ON sender.id = messages.sender_id
-		WHERE (chats.user1_id = ? OR chats.user2_id = ?) AND users.id != ?
+		WHERE (chats.user1_id = ? OR chats.user2_id = ?) AND users.id != ? AND chats.deleted_at IS NULL AND chats.closed_at IS NULL
+		ORDER BY last_message_at DESC, chats.id DESC
 	`
-	err := repo.db.Raw(query, userID, userID, userID).Find(&results).Error
+	err := repo.db.Raw(query, userID, userID, userID, userID).Find(&results).Error
 	if err != nil {
 		return nil, err
 	}
 	return &results, nil
 }
 
+// CloseChat closes every open chat between the two users.
+func (repo *PostgresChatRepo) CloseChat(userID uint, otherID uint, closedAt time.Time) ([]models.Chat, error) {
+	var chats []models.Chat
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("closed_at IS NULL").
+			Where("(user1_id = ? AND user2_id = ?) OR (user1_id = ? AND user2_id = ?)", userID, otherID, otherID, userID).
+			Find(&chats).Error; err != nil {
+			return err
+		}
+		for i := range chats {
+			chats[i].ClosedAt = &closedAt
+			chats[i].ClosedByID = &userID
+			if err := tx.Model(&chats[i]).Select("closed_at", "closed_by_id").Updates(&chats[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
 func (repo *PostgresChatRepo) GetLastMessageByChatID(chatID uint) (*models.Message, error) {
 	var message models.Message
 	query := `SELECT * FROM messages WHERE chat_id = ? ORDER BY created_at DESC LIMIT 1`
@@ -166,4 +311,66 @@ func (repo *PostgresChatRepo) GetLastMessageByChatID(chatID uint) (*models.Messa
 		return nil, err
 	}
 	return &message, nil
-}
\ No newline at end of file
+}
+
+func (repo *PostgresChatRepo) GetUserMessages(userID uint) (*[]models.Message, error) {
+	var messages []models.Message
+	if err := repo.db.Model(&models.Message{}).
+		Where("sender_id = ? OR receiver_id = ?", userID, userID).
+		Order("created_at").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return &messages, nil
+}
+
+func (repo *PostgresChatRepo) GetMessageByClientMsgID(senderID uint, clientMsgID string) (*models.Message, error) {
+	var message models.Message
+	if err := repo.db.Where("sender_id = ? AND client_msg_id = ?", senderID, clientMsgID).First(&message).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetUserMessagesAfter returns messages of all chats of the user which follow
+// afterID in the (created_at, id) order. Both are assigned before the insert
+// commits, so a message committed late can sort before the one the client has
+// seen last: overlap moves the cursor back to return such messages too, the
+// client skips the ones it already has by id.
+func (repo *PostgresChatRepo) GetUserMessagesAfter(userID uint, afterID uint, overlap time.Duration, limit int) (*[]models.Message, error) {
+	var messages []models.Message
+	query := repo.db.Model(&models.Message{}).Preload("Attachments").
+		Where("(sender_id = ? OR receiver_id = ?)", userID, userID).
+		Where("chat_id IN (SELECT id FROM chats WHERE closed_at IS NULL)").
+		Where(hiddenForUser, userID)
+	if afterID != 0 {
+		var cursor models.Message
+		err := repo.db.Select("id", "created_at").First(&cursor, afterID).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// the message was purged with its sender, ids are the best cursor left
+			query = query.Where("id > ?", afterID)
+		case err != nil:
+			return nil, err
+		case overlap > 0:
+			query = query.Where("created_at > ?", cursor.CreatedAt.Add(-overlap))
+		default:
+			query = query.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	}
+	if err := query.Order("created_at, id").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Redact()
+	}
+	return &messages, nil
+}
+
+// MarkMessagesRead marks every unread message received by readerID in the chat
+// up to upToID, it returns the number of messages which became read.
+func (repo *PostgresChatRepo) MarkMessagesRead(chatID uint, readerID uint, upToID uint, readAt time.Time) (int64, error) {
+	result := repo.db.Model(&models.Message{}).
+		Where("chat_id = ? AND receiver_id = ? AND id <= ? AND read_at IS NULL", chatID, readerID, upToID).
+		Updates(map[string]interface{}{"read_at": readAt, "is_read": true})
+	return result.RowsAffected, result.Error
+}
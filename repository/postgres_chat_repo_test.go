@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func messageIDs(messages *[]models.Message) []uint {
+	ids := make([]uint, len(*messages))
+	for i, message := range *messages {
+		ids[i] = message.ID
+	}
+	return ids
+}
+
+func TestGetMessagesByIDChatPagesByCreatedAt(t *testing.T) {
+	db := config.DB
+	alice := models.User{Username: "history_alice", Email: "history_alice@example.com"}
+	bob := models.User{Username: "history_bob", Email: "history_bob@example.com"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	chat := models.Chat{User1ID: alice.ID, User2ID: bob.ID}
+	require.NoError(t, db.Create(&chat).Error)
+
+	// ids don't follow created_at: the offsets are the chronological order
+	start := time.Now().Add(-time.Hour)
+	var byTime [5]uint
+	for _, offset := range []int{2, 0, 4, 1, 3} {
+		message := models.Message{ChatID: chat.ID, SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"}
+		message.CreatedAt = start.Add(time.Duration(offset) * time.Minute)
+		require.NoError(t, db.Create(&message).Error)
+		byTime[offset] = message.ID
+	}
+
+	repo := NewPostgresChatRepo(db)
+	latest, hasMore, err := repo.GetMessagesByIDChat(chat.ID, alice.ID, MessagePage{Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []uint{byTime[3], byTime[4]}, messageIDs(latest))
+
+	older, hasMore, err := repo.GetMessagesByIDChat(chat.ID, alice.ID, MessagePage{BeforeID: byTime[3], Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []uint{byTime[1], byTime[2]}, messageIDs(older))
+
+	oldest, hasMore, err := repo.GetMessagesByIDChat(chat.ID, alice.ID, MessagePage{BeforeID: byTime[1], Limit: 2})
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Equal(t, []uint{byTime[0]}, messageIDs(oldest))
+
+	newer, hasMore, err := repo.GetMessagesByIDChat(chat.ID, alice.ID, MessagePage{AfterID: byTime[1], Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []uint{byTime[2], byTime[3]}, messageIDs(newer))
+}
+
+func TestGetUserMessagesAfterReturnsLateCommits(t *testing.T) {
+	db := config.DB
+	alice := models.User{Username: "resume_alice", Email: "resume_alice@example.com"}
+	bob := models.User{Username: "resume_bob", Email: "resume_bob@example.com"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	chat := models.Chat{User1ID: alice.ID, User2ID: bob.ID}
+	require.NoError(t, db.Create(&chat).Error)
+
+	start := time.Now().Add(-time.Hour)
+	newMessage := func(offset time.Duration) models.Message {
+		message := models.Message{ChatID: chat.ID, SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"}
+		message.CreatedAt = start.Add(offset)
+		require.NoError(t, db.Create(&message).Error)
+		return message
+	}
+	seen := newMessage(0)
+	next := newMessage(time.Second)
+	// committed after the client had seen `seen`, but created a moment before it
+	late := newMessage(-time.Second)
+
+	repo := NewPostgresChatRepo(db)
+	withOverlap, err := repo.GetUserMessagesAfter(bob.ID, seen.ID, 5*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{late.ID, seen.ID, next.ID}, messageIDs(withOverlap))
+
+	strict, err := repo.GetUserMessagesAfter(bob.ID, seen.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{next.ID}, messageIDs(strict))
+
+	all, err := repo.GetUserMessagesAfter(bob.ID, 0, 5*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{late.ID, seen.ID, next.ID}, messageIDs(all))
+}
+
+func TestDeleteMessageForEveryoneKeepsConcurrentChanges(t *testing.T) {
+	db := config.DB
+	alice := models.User{Username: "unsend_alice", Email: "unsend_alice@example.com"}
+	bob := models.User{Username: "unsend_bob", Email: "unsend_bob@example.com"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	chat := models.Chat{User1ID: alice.ID, User2ID: bob.ID}
+	require.NoError(t, db.Create(&chat).Error)
+	message := models.Message{ChatID: chat.ID, SenderID: alice.ID, ReceiverID: bob.ID, Content: "hi"}
+	require.NoError(t, db.Create(&message).Error)
+
+	repo := NewPostgresChatRepo(db)
+	loaded, err := repo.GetMessageByID(message.ID)
+	require.NoError(t, err)
+	// the receiver reads the message after it was loaded for the deletion
+	read, err := repo.MarkMessagesRead(chat.ID, bob.ID, message.ID, time.Now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, read)
+
+	now := time.Now()
+	loaded.DeletedForEveryoneAt = &now
+	require.NoError(t, repo.DeleteMessageForEveryone(loaded))
+
+	var stored models.Message
+	require.NoError(t, db.First(&stored, message.ID).Error)
+	assert.NotNil(t, stored.DeletedForEveryoneAt)
+	assert.NotNil(t, stored.ReadAt)
+	assert.True(t, stored.IsRead)
+}
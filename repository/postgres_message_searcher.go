@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"github.com/ilyaDyb/go_rest_api/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// searchConfig is the text search configuration, "simple" doesn't stem words so
+// it works the same for every language users write in.
+const searchConfig = "simple"
+
+// PostgresMessageSearcher uses the GIN index on to_tsvector(content), see config.Connect.
+type PostgresMessageSearcher struct {
+	db *gorm.DB
+}
+
+func NewPostgresMessageSearcher(db *gorm.DB) *PostgresMessageSearcher {
+	return &PostgresMessageSearcher{db: db}
+}
+
+func (s *PostgresMessageSearcher) SearchMessages(userID uint, query string, limit int) (*[]utils.MessageSearchResponse, error) {
+	var results []utils.MessageSearchResponse
+	headlineOptions := `StartSel="` + rawSnippetStart + `", StopSel="` + rawSnippetStop + `", MaxWords=20, MinWords=5, MaxFragments=1`
+	err := searchableMessages(s.db, userID).
+		Select(`messages.chat_id, messages.id AS message_id, messages.sender_id, messages.created_at,
+			ts_headline(?, translate(messages.content, ?, ''), plainto_tsquery(?, ?), ?) AS snippet`,
+			searchConfig, rawSnippetStart+rawSnippetStop, searchConfig, query, headlineOptions).
+		Where("to_tsvector(?, messages.content) @@ plainto_tsquery(?, ?)", searchConfig, searchConfig, query).
+		// Order drops expressions with arguments, the clause is set directly
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "ts_rank(to_tsvector(?, messages.content), plainto_tsquery(?, ?)) DESC, messages.created_at DESC",
+			Vars: []interface{}{searchConfig, searchConfig, query},
+		}}).
+		Limit(limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Snippet = escapeSnippet(results[i].Snippet)
+	}
+	return &results, nil
+}
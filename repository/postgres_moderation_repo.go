@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"github.com/ilyaDyb/go_rest_api/models"
+	"gorm.io/gorm"
+)
+
+// blockedWith selects ids of users blocked by the user or blocking the user,
+// the user is passed twice.
+const blockedWith = `SELECT blocked_id FROM blocks WHERE blocker_id = ? AND deleted_at IS NULL
+	UNION SELECT blocker_id FROM blocks WHERE blocked_id = ? AND deleted_at IS NULL`
+
+type PostgresModerationRepo struct {
+	db *gorm.DB
+}
+
+func NewPostgresModerationRepo(db *gorm.DB) *PostgresModerationRepo {
+	return &PostgresModerationRepo{db: db}
+}
+
+// CreateBlock is idempotent, blocking the same user again keeps the first block.
+func (repo *PostgresModerationRepo) CreateBlock(block *models.Block) error {
+	return repo.db.Where(models.Block{BlockerID: block.BlockerID, BlockedID: block.BlockedID}).
+		FirstOrCreate(block).Error
+}
+
+func (repo *PostgresModerationRepo) DeleteBlock(blockerID uint, blockedID uint) error {
+	return repo.db.Unscoped().Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Delete(&models.Block{}).Error
+}
+
+func (repo *PostgresModerationRepo) GetBlocks(blockerID uint) ([]models.Block, error) {
+	var blocks []models.Block
+	if err := repo.db.Preload("Blocked.Photo", "is_preview = ?", true).
+		Where("blocker_id = ?", blockerID).Order("id DESC").Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// IsBlocked reports whether either of the users blocked the other one.
+func (repo *PostgresModerationRepo) IsBlocked(userID uint, otherID uint) (bool, error) {
+	var count int64
+	err := repo.db.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (repo *PostgresModerationRepo) CreateReport(report *models.Report) error {
+	return repo.db.Create(report).Error
+}
+
+// GetReports returns the queue with the given status, the oldest reports first.
+func (repo *PostgresModerationRepo) GetReports(status string, limit int, offset int) ([]models.Report, error) {
+	var reports []models.Report
+	if err := repo.db.Preload("Reporter").Preload("Reported").
+		Where("status = ?", status).Order("created_at, id").
+		Limit(limit).Offset(offset).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (repo *PostgresModerationRepo) GetReportsCount(status string) (int64, error) {
+	var count int64
+	err := repo.db.Model(&models.Report{}).Where("status = ?", status).Count(&count).Error
+	return count, err
+}
+
+func (repo *PostgresModerationRepo) GetReportByID(reportID uint) (*models.Report, error) {
+	var report models.Report
+	if err := repo.db.Preload("Reporter").Preload("Reported").Preload("Messages.Edits").
+		First(&report, reportID).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (repo *PostgresModerationRepo) UpdateReport(report *models.Report) error {
+	return repo.db.Omit("Messages", "Reporter", "Reported").Save(report).Error
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PostgresSubscriptionRepo struct {
+	db *gorm.DB
+}
+
+func NewPostgresSubscriptionRepo(db *gorm.DB) *PostgresSubscriptionRepo {
+	return &PostgresSubscriptionRepo{db: db}
+}
+
+func activeAt(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("canceled_at IS NULL AND expires_at > ?", now)
+}
+
+// GetActiveSubscription returns the active subscription of the best plan, of
+// them the one which lasts longest.
+func (repo *PostgresSubscriptionRepo) GetActiveSubscription(userID uint, now time.Time) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if err := activeAt(repo.db, now).Where("user_id = ?", userID).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "CASE plan WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, expires_at DESC",
+			Vars: []interface{}{config.PlanPremium, config.PlanPlus},
+		}}).Take(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (repo *PostgresSubscriptionRepo) GetSubscriptions(userID uint) ([]models.Subscription, error) {
+	var subscriptions []models.Subscription
+	if err := repo.db.Where("user_id = ?", userID).Order("id DESC").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// GrantSubscription replaces the earlier grants of admins, subscriptions paid
+// through a provider stay active and keep renewing.
+func (repo *PostgresSubscriptionRepo) GrantSubscription(subscription *models.Subscription, now time.Time) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		grants := tx.Where("provider = ?", models.SubscriptionProviderAdmin)
+		if err := revoke(grants, subscription.UserID, now); err != nil {
+			return err
+		}
+		return tx.Create(subscription).Error
+	})
+}
+
+func (repo *PostgresSubscriptionRepo) CancelSubscriptions(userID uint, at time.Time) error {
+	return revoke(repo.db, userID, at)
+}
+
+// revoke cancels the active subscriptions of the user for good, see models.Subscription.RevokedAt.
+func revoke(db *gorm.DB, userID uint, at time.Time) error {
+	return activeAt(db.Model(&models.Subscription{}), at).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"canceled_at": at, "revoked_at": at}).Error
+}
+
+// ApplyPaymentEvent stores the event and updates the subscription it is about,
+// it returns ErrPaymentEventProcessed for events which were already applied.
+func (repo *PostgresSubscriptionRepo) ApplyPaymentEvent(event *models.PaymentEvent, now time.Time) error {
+	err := repo.applyPaymentEvent(event, now)
+	if err == nil {
+		return nil
+	}
+	// the unique index keeps retries and concurrent deliveries of the event from
+	// being stored twice, the insert fails for them
+	var processed int64
+	if countErr := repo.db.Model(&models.PaymentEvent{}).
+		Where("provider = ? AND event_id = ?", event.Provider, event.EventID).
+		Count(&processed).Error; countErr == nil && processed > 0 {
+		return ErrPaymentEventProcessed
+	}
+	return err
+}
+
+func (repo *PostgresSubscriptionRepo) applyPaymentEvent(event *models.PaymentEvent, now time.Time) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+
+		var subscription models.Subscription
+		err := tx.Where("provider = ? AND external_id = ?", event.Provider, event.SubscriptionID).First(&subscription).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		found := err == nil
+
+		switch event.Type {
+		case models.PaymentEventSubscriptionActive:
+			if !found {
+				externalID := event.SubscriptionID
+				subscription = models.Subscription{
+					UserID:     event.UserID,
+					Provider:   event.Provider,
+					ExternalID: &externalID,
+				}
+			}
+			// webhooks may come out of order, an older event must neither shorten
+			// nor reactivate the subscription
+			if event.ExpiresAt.Before(subscription.ExpiresAt) {
+				return nil
+			}
+			subscription.Plan = event.Plan
+			if event.ExpiresAt.After(subscription.ExpiresAt) {
+				subscription.ExpiresAt = event.ExpiresAt
+				if subscription.RevokedAt == nil {
+					subscription.CanceledAt = nil
+				}
+			}
+			return tx.Save(&subscription).Error
+		case models.PaymentEventSubscriptionCanceled:
+			if !found || subscription.CanceledAt != nil {
+				return nil
+			}
+			return tx.Model(&subscription).Update("canceled_at", now).Error
+		}
+		return nil
+	})
+}
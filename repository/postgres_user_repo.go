@@ -3,12 +3,11 @@ package repository
 import (
 	"fmt"
 	"log"
-	"sort"
+	"time"
 
 	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/geo"
 	"github.com/ilyaDyb/go_rest_api/models"
-	"github.com/ilyaDyb/go_rest_api/utils"
-	"github.com/rosberry/go-pagination"
 	"gorm.io/gorm"
 )
 
@@ -22,8 +21,8 @@ func NewPostgresUserRepo(db *gorm.DB) *PostgresUserRepo {
 
 func (repo *PostgresUserRepo) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
-	if err := repo.db.Preload("Photo").Where("username = ? AND is_active = ?", username, true).First(&user).Error; err != nil{
-	// if err := repo.db.Preload("Photo").Where("username = ?", username).First(&user).Error; err != nil{
+	if err := repo.db.Preload("Photo").Where("username = ? AND is_active = ?", username, true).First(&user).Error; err != nil {
+		// if err := repo.db.Preload("Photo").Where("username = ?", username).First(&user).Error; err != nil{
 		return nil, err
 	}
 	// if user.ID == 0 {
@@ -78,53 +77,130 @@ func (repo *PostgresUserRepo) SaveLocation(username string, lat float32, lon flo
 }
 
 func (repo *PostgresUserRepo) GetUsersWhoLikedMe(userID uint) ([]models.User, error) {
-    var usersIdsWhichLikedMe []uint
-    if err := repo.db.Model(&models.UserInteraction{}).Where("target_id = ? AND is_relevant = ?", userID, true).Pluck("user_id", &usersIdsWhichLikedMe).Error; err != nil {
-        return nil, err
-    }
+	var usersIdsWhichLikedMe []uint
+	if err := repo.db.Model(&models.UserInteraction{}).
+		Where("target_id = ? AND is_relevant = ? AND interaction_type IN ?", userID, true, models.LikeInteractions).
+		Pluck("user_id", &usersIdsWhichLikedMe).Error; err != nil {
+		return nil, err
+	}
+	curUser, prefs, err := repo.discoveryContext(userID)
+	if err != nil {
+		return nil, err
+	}
 
-    var usersWhichLikedMe []models.User
-    if err := repo.db.Preload("Photo").Where("id IN (?)", usersIdsWhichLikedMe).Find(&usersWhichLikedMe).Error; err != nil {
-        return nil, err
-    }
+	var usersWhichLikedMe []models.User
+	if err := repo.db.Preload("Photo").Model(&models.User{}).
+		Scopes(discoveryScope(curUser, prefs)).
+		Where("users.id IN (?) AND users.is_deactivated = ?", usersIdsWhichLikedMe, false).
+		Where("users.id NOT IN ("+blockedWith+")", userID, userID).Find(&usersWhichLikedMe).Error; err != nil {
+		return nil, err
+	}
+	if err := repo.markSuperlikers(userID, usersWhichLikedMe); err != nil {
+		return nil, err
+	}
 
-    return usersWhichLikedMe, nil
+	return usersWhichLikedMe, nil
 }
 
-func (repo *PostgresUserRepo) GetUsersList(userID uint, role string, paginator *pagination.Paginator) ([]models.User, error) {
-	var curUser models.User
-	config.DB.First(&curUser, userID)
+// GetFeedCandidates returns the pool of profiles which can be shown to the user,
+// boosted profiles first so they always get into the pool, then the closest, or
+// the most recently active when the user has no location. The pool is ranked by
+// the caller.
+func (repo *PostgresUserRepo) GetFeedCandidates(userID uint, role string, limit int) ([]models.User, error) {
+	curUser, prefs, err := repo.discoveryContext(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := repo.db.Preload("Photo", "is_preview = ?", true).Model(&models.User{}).
+		Scopes(discoveryScope(curUser, prefs)).
+		Where("users.role = ?", role).
+		Where("users.id != ?", userID).
+		Where("users.is_deactivated = ?", false).
+		Where("users.id NOT IN (SELECT target_id FROM user_interactions WHERE user_id = ? AND deleted_at IS NULL)", userID).
+		Where("users.id NOT IN ("+blockedWith+")", userID, userID).
+		Order("CASE WHEN users.boosted_until > CURRENT_TIMESTAMP THEN 0 ELSE 1 END")
+	if geo.HasLocation(float64(curUser.Lat), float64(curUser.Lon)) {
+		query = config.Spatial.OrderByDistance(query, float64(curUser.Lat), float64(curUser.Lon))
+	}
 
 	var users []models.User
+	err = query.Order("users.last_active_at DESC NULLS LAST, users.id").
+		Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.markSuperlikers(userID, users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
 
-	var interactedIDs []uint
-	config.DB.Model(&models.UserInteraction{}).Where("user_id = ?", userID).Pluck("target_id", &interactedIDs)
-
-	gender := "male"
-	if curUser.Sex == "male" {
-		gender = "female"
-	} else {
-		gender = "male"
+// markSuperlikers sets SuperlikedMe on the users who superliked the user.
+func (repo *PostgresUserRepo) markSuperlikers(userID uint, users []models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	var superlikerIDs []uint
+	if err := repo.db.Model(&models.UserInteraction{}).
+		Where("target_id = ? AND interaction_type = ? AND user_id IN ?", userID, models.InteractionSuperlike, ids).
+		Pluck("user_id", &superlikerIDs).Error; err != nil {
+		return err
 	}
+	superlikers := make(map[uint]bool, len(superlikerIDs))
+	for _, id := range superlikerIDs {
+		superlikers[id] = true
+	}
+	for i := range users {
+		users[i].SuperlikedMe = superlikers[users[i].ID]
+	}
+	return nil
+}
+
+func (repo *PostgresUserRepo) TouchLastActive(userID uint, at time.Time) error {
+	return repo.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("last_active_at", at).Error
+}
 
-	q := config.DB.Preload("Photo", "is_preview = ?", true).Model(&models.User{}).
-		Where("role = ?", role).
-		Where("id != ?", userID).
-		Where("sex = ?", gender).
-		Where("id NOT IN (?)", interactedIDs).Limit(10)
+func (repo *PostgresUserRepo) SetBoostedUntil(userID uint, until time.Time) error {
+	return repo.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("boosted_until", until).Error
+}
+
+// discoveryContext loads the user with photos and the discovery preferences of the user.
+func (repo *PostgresUserRepo) discoveryContext(userID uint) (*models.User, *models.DiscoveryPreferences, error) {
+	var user models.User
+	if err := repo.db.Preload("Photo").First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+	prefs, err := repo.GetDiscoveryPreferences(&user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, prefs, nil
+}
 
-	err := paginator.Find(q, &users)
+func (repo *PostgresUserRepo) GetDiscoveryPreferences(user *models.User) (*models.DiscoveryPreferences, error) {
+	var prefs models.DiscoveryPreferences
+	err := repo.db.Where("user_id = ?", user.ID).First(&prefs).Error
+	if err == gorm.ErrRecordNotFound {
+		return models.DefaultDiscoveryPreferences(user), nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	scores := make(map[uint]float64)
-	for _, u := range users {
-		scores[u.ID] = utils.CalculateScore(curUser, u)
+	return &prefs, nil
+}
+
+func (repo *PostgresUserRepo) SaveDiscoveryPreferences(prefs *models.DiscoveryPreferences) error {
+	var existing models.DiscoveryPreferences
+	if err := repo.db.Where("user_id = ?", prefs.UserID).First(&existing).Error; err == nil {
+		prefs.ID = existing.ID
+		prefs.CreatedAt = existing.CreatedAt
 	}
-	sort.Slice(users, func(i, j int) bool {
-		return scores[users[i].ID] > scores[users[j].ID]
-	})
-	return users, nil
+	return repo.db.Save(prefs).Error
 }
 
 func (repo *PostgresUserRepo) AddUserInteraction(interaction *models.UserInteraction) error {
@@ -139,15 +215,36 @@ func (repo *PostgresUserRepo) GetUserInteractionsCount(userID uint) (int64, erro
 	return userInteractionsCount, nil
 }
 
+func (repo *PostgresUserRepo) GetUserInteractions(userID uint) ([]models.UserInteraction, error) {
+	var interactions []models.UserInteraction
+	if err := repo.db.Where("user_id = ?", userID).Order("created_at").Find(&interactions).Error; err != nil {
+		return nil, err
+	}
+	return interactions, nil
+}
+
+// GetLastUserInteraction returns the latest interaction made by the user.
+func (repo *PostgresUserRepo) GetLastUserInteraction(userID uint) (*models.UserInteraction, error) {
+	var interaction models.UserInteraction
+	if err := repo.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").First(&interaction).Error; err != nil {
+		return nil, err
+	}
+	return &interaction, nil
+}
+
+func (repo *PostgresUserRepo) DeleteUserInteraction(interaction *models.UserInteraction) error {
+	return repo.db.Delete(interaction).Error
+}
+
 func (repo *PostgresUserRepo) GetUserInteraction(userID, targetID uint) (*models.UserInteraction, error) {
 	var userInteraction models.UserInteraction
 	if err := config.DB.Model(&models.UserInteraction{}).Where("user_id = ? AND target_id = ?").First(&userInteraction).Error; err != nil {
 		return nil, err
 	}
-	return &userInteraction, nil 
+	return &userInteraction, nil
 }
 
-func (repo *PostgresUserRepo) UserIsExists(username string, email string) (bool, error){
+func (repo *PostgresUserRepo) UserIsExists(username string, email string) (bool, error) {
 	query := "SELECT EXISTS (SELECT 1 FROM users WHERE username = ? OR email = ?)"
 	var exists bool
 	if err := config.DB.Raw(query, username, email).Scan(&exists).Error; err != nil {
@@ -157,27 +254,35 @@ func (repo *PostgresUserRepo) UserIsExists(username string, email string) (bool,
 }
 
 func (repo *PostgresUserRepo) GetUserByHash(hash string) (*models.User, error) {
-    var user models.User
-    if err := repo.db.Where("confirmation_hash = ?", hash).First(&user).Error; err != nil {
-        return nil, err
-    }
-    return &user, nil
+	var user models.User
+	if err := repo.db.Where("confirmation_hash = ?", hash).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (repo *PostgresUserRepo) GetUserByEmailChangeHash(hash string) (*models.User, error) {
+	var user models.User
+	if err := repo.db.Where("email_change_hash = ?", hash).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 func (repo *PostgresUserRepo) GetUsersCount() (int, error) {
-    var count int64
-    if err := repo.db.Model(&models.User{}).Count(&count).Error; err != nil {
-        return 0, err
-    }
-    return int(count), nil
+	var count int64
+	if err := repo.db.Model(&models.User{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
 }
 
 func (repo *PostgresUserRepo) GetAllUsers(limit int, offset int) ([]models.User, error) {
-    var users []models.User
-    if err := repo.db.Limit(limit).Offset(offset).Order("id DESC").Find(&users).Error; err != nil {
-        return users, fmt.Errorf("err")
-    }
-    return users, nil
+	var users []models.User
+	if err := repo.db.Limit(limit).Offset(offset).Order("id DESC").Find(&users).Error; err != nil {
+		return users, fmt.Errorf("err")
+	}
+	return users, nil
 }
 
 func (repo *PostgresUserRepo) IsExistsEmail(email string) (bool, error) {
@@ -201,4 +306,43 @@ func (repo *PostgresUserRepo) GetUserByEmail(email string) (*models.User, error)
 	}
 	log.Printf("Found user: %v\n", user)
 	return &user, nil
-}
\ No newline at end of file
+}
+
+func (repo *PostgresUserRepo) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks the code as used, false is returned if there is no unused code with such hash.
+func (repo *PostgresUserRepo) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	res := repo.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used = ?", userID, codeHash, false).
+		Update("used", true)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (repo *PostgresUserRepo) GetLinkedIdentity(provider string, subject string) (*models.LinkedIdentity, error) {
+	var identity models.LinkedIdentity
+	if err := repo.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (repo *PostgresUserRepo) CreateLinkedIdentity(identity *models.LinkedIdentity) error {
+	return repo.db.Create(identity).Error
+}
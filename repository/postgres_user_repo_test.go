@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFeedCandidatesIncludesBoosted(t *testing.T) {
+	db := config.DB
+	newUser := func(username string, sex string, lastActiveAt time.Time, boostedUntil *time.Time) models.User {
+		user := models.User{
+			Username:     username,
+			Email:        username + "@example.com",
+			Role:         "feed_test",
+			IsActive:     true,
+			Sex:          sex,
+			Age:          30,
+			LastActiveAt: &lastActiveAt,
+			BoostedUntil: boostedUntil,
+		}
+		require.NoError(t, db.Create(&user).Error)
+		return user
+	}
+	now := time.Now()
+	viewer := newUser("feed_viewer", "male", now, nil)
+	active := newUser("feed_active", "female", now.Add(-time.Hour), nil)
+	newUser("feed_idle", "female", now.Add(-2*time.Hour), nil)
+	boosted := newUser("feed_boosted", "female", now.Add(-30*24*time.Hour), ptrTime(now.Add(24*time.Hour)))
+	newUser("feed_boost_ended", "female", now.Add(-3*time.Hour), ptrTime(now.Add(-24*time.Hour)))
+
+	candidates, err := NewPostgresUserRepo(db).GetFeedCandidates(viewer.ID, "feed_test", 2)
+	require.NoError(t, err)
+	require.Len(t, candidates, 2)
+	assert.Equal(t, boosted.ID, candidates[0].ID)
+	assert.Equal(t, active.ID, candidates[1].ID)
+}
+
+func TestGetFeedCandidatesMatchesSexExactly(t *testing.T) {
+	db := config.DB
+	newUser := func(username string, sex string) models.User {
+		user := models.User{Username: username, Email: username + "@example.com", Role: "sex_test", IsActive: true, Sex: sex, Age: 30}
+		require.NoError(t, db.Create(&user).Error)
+		return user
+	}
+	// the candidate wants only men by default
+	candidate := newUser("sex_candidate", models.SexFemale)
+	man := newUser("sex_man", models.SexMale)
+	repo := NewPostgresUserRepo(db)
+
+	for _, sex := range []string{"%", "_ale", `"`} {
+		viewer := newUser("sex_viewer_"+sex, sex)
+		candidates, err := repo.GetFeedCandidates(viewer.ID, "sex_test", 10)
+		require.NoError(t, err)
+		for _, user := range candidates {
+			assert.NotEqual(t, candidate.ID, user.ID, "sex %q matched the preferences", sex)
+		}
+	}
+
+	candidates, err := repo.GetFeedCandidates(man.ID, "sex_test", 10)
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, candidate.ID, candidates[0].ID)
+}
@@ -0,0 +1,12 @@
+package repository
+
+import "time"
+
+// QuotaRepo keeps usage counters of limited actions.
+type QuotaRepo interface {
+	// Incr adds one use to the counter and returns the uses so far,
+	// the counter is dropped at expireAt.
+	Incr(key string, expireAt time.Time) (int64, error)
+	Decr(key string) error
+	Get(key string) (int64, error)
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const quotaKeyPrefix = "quota:"
+
+type RedisQuotaRepo struct {
+	rdb *redis.Client
+}
+
+func NewRedisQuotaRepo(rdb *redis.Client) *RedisQuotaRepo {
+	return &RedisQuotaRepo{rdb: rdb}
+}
+
+func (repo *RedisQuotaRepo) Incr(key string, expireAt time.Time) (int64, error) {
+	ctx := context.Background()
+	pipe := repo.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, quotaKeyPrefix+key)
+	pipe.ExpireAt(ctx, quotaKeyPrefix+key, expireAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (repo *RedisQuotaRepo) Decr(key string) error {
+	return repo.rdb.Decr(context.Background(), quotaKeyPrefix+key).Err()
+}
+
+func (repo *RedisQuotaRepo) Get(key string) (int64, error) {
+	used, err := repo.rdb.Get(context.Background(), quotaKeyPrefix+key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return used, err
+}
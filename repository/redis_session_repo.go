@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionKeyPrefix      = "session:"
+	userSessionsKeyPrefix = "user_sessions:"
+)
+
+type RedisSessionRepo struct {
+	rdb *redis.Client
+}
+
+func NewRedisSessionRepo(rdb *redis.Client) *RedisSessionRepo {
+	return &RedisSessionRepo{rdb: rdb}
+}
+
+func sessionKey(sessionID string) string {
+	return sessionKeyPrefix + sessionID
+}
+
+func userSessionsKey(username string) string {
+	return userSessionsKeyPrefix + username
+}
+
+func (repo *RedisSessionRepo) CreateSession(session *models.Session, ttl time.Duration) error {
+	return repo.UpdateSession(session, ttl)
+}
+
+func (repo *RedisSessionRepo) UpdateSession(session *models.Session, ttl time.Duration) error {
+	ctx := context.Background()
+	pipe := repo.rdb.TxPipeline()
+	pipe.HSet(ctx, sessionKey(session.ID), map[string]interface{}{
+		"username":     session.Username,
+		"refresh_id":   session.RefreshID,
+		"device":       session.Device,
+		"ip":           session.IP,
+		"created_at":   session.CreatedAt.Unix(),
+		"last_used_at": session.LastUsedAt.Unix(),
+	})
+	pipe.Expire(ctx, sessionKey(session.ID), ttl)
+	pipe.SAdd(ctx, userSessionsKey(session.Username), session.ID)
+	pipe.Expire(ctx, userSessionsKey(session.Username), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// rotateSessionScript compares and swaps the refresh id in one step, so two
+// refreshes with the same token can't both pass the check.
+var rotateSessionScript = redis.NewScript(`
+local current = redis.call("HGET", KEYS[1], "refresh_id")
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	return -1
+end
+redis.call("HSET", KEYS[1], "refresh_id", ARGV[2], "ip", ARGV[3], "last_used_at", ARGV[4])
+redis.call("EXPIRE", KEYS[1], ARGV[5])
+redis.call("EXPIRE", KEYS[2], ARGV[5])
+return 1
+`)
+
+func (repo *RedisSessionRepo) RotateSession(session *models.Session, refreshID string, ttl time.Duration) error {
+	result, err := rotateSessionScript.Run(context.Background(), repo.rdb,
+		[]string{sessionKey(session.ID), userSessionsKey(session.Username)},
+		refreshID, session.RefreshID, session.IP, session.LastUsedAt.Unix(), int64(ttl.Seconds()),
+	).Int()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case 0:
+		return ErrSessionNotFound
+	case -1:
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (repo *RedisSessionRepo) GetSession(sessionID string) (*models.Session, error) {
+	fields, err := repo.rdb.HGetAll(context.Background(), sessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	lastUsedAt, _ := strconv.ParseInt(fields["last_used_at"], 10, 64)
+	return &models.Session{
+		ID:         sessionID,
+		Username:   fields["username"],
+		RefreshID:  fields["refresh_id"],
+		Device:     fields["device"],
+		IP:         fields["ip"],
+		CreatedAt:  time.Unix(createdAt, 0),
+		LastUsedAt: time.Unix(lastUsedAt, 0),
+	}, nil
+}
+
+func (repo *RedisSessionRepo) GetUserSessions(username string) ([]models.Session, error) {
+	ctx := context.Background()
+	ids, err := repo.rdb.SMembers(ctx, userSessionsKey(username)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]models.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := repo.GetSession(id)
+		if err == ErrSessionNotFound {
+			// session key expired, drop the dangling id from the index
+			repo.rdb.SRem(ctx, userSessionsKey(username), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+func (repo *RedisSessionRepo) DeleteSession(session *models.Session) error {
+	ctx := context.Background()
+	pipe := repo.rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(session.ID))
+	pipe.SRem(ctx, userSessionsKey(session.Username), session.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (repo *RedisSessionRepo) DeleteUserSessions(username string) error {
+	ctx := context.Background()
+	ids, err := repo.rdb.SMembers(ctx, userSessionsKey(username)).Result()
+	if err != nil {
+		return err
+	}
+	pipe := repo.rdb.TxPipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, sessionKey(id))
+	}
+	pipe.Del(ctx, userSessionsKey(username))
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrRefreshTokenReused = errors.New("refresh token was already rotated")
+)
+
+type SessionRepo interface {
+	CreateSession(session *models.Session, ttl time.Duration) error
+	UpdateSession(session *models.Session, ttl time.Duration) error
+	// RotateSession stores the new RefreshID, IP and LastUsedAt of the session only if
+	// the stored refresh id is still refreshID, otherwise it returns ErrRefreshTokenReused.
+	RotateSession(session *models.Session, refreshID string, ttl time.Duration) error
+	GetSession(sessionID string) (*models.Session, error)
+	GetUserSessions(username string) ([]models.Session, error)
+	DeleteSession(session *models.Session) error
+	DeleteUserSessions(username string) error
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+)
+
+var ErrPaymentEventProcessed = errors.New("payment event is already processed")
+
+type SubscriptionRepo interface {
+	GetActiveSubscription(userID uint, now time.Time) (*models.Subscription, error)
+	GetSubscriptions(userID uint) ([]models.Subscription, error)
+	// GrantSubscription revokes the active subscriptions of the user and creates the new one.
+	GrantSubscription(subscription *models.Subscription, now time.Time) error
+	CancelSubscriptions(userID uint, at time.Time) error
+	ApplyPaymentEvent(event *models.PaymentEvent, now time.Time) error
+}
@@ -1,27 +1,40 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/ilyaDyb/go_rest_api/models"
-	"github.com/rosberry/go-pagination"
 )
 
 type UserRepo interface {
 	GetUserByUsername(username string) (*models.User, error)
-    GetUserByID(ID uint) (*models.User, error)
-    CreateUser(user *models.User) error
-    UpdateUser(user *models.User) error
-    DeleteUser(user *models.User) error
-    SetPreviewPhoto(userID uint, photoID uint) error
-    SaveLocation(username string, lat float32, lon float32) error
-    GetUsersWhoLikedMe(userID uint) ([]models.User, error)
-    GetUsersList(userID uint, role string, paginator *pagination.Paginator) ([]models.User, error)
-    AddUserInteraction(interaction *models.UserInteraction) error
-    GetUserInteraction(userID, targetID uint) (*models.UserInteraction, error)
-    GetUserInteractionsCount(userID uint) (int64, error)
-    UserIsExists(username string, email string) (bool, error)
-    GetUserByHash(hash string) (*models.User, error)
-    GetAllUsers(limit int, page int) ([]models.User, error)
-    GetUsersCount() (int, error)
-    IsExistsEmail(email string) (bool, error)
-    GetUserByEmail(email string) (*models.User, error)
-}
\ No newline at end of file
+	GetUserByID(ID uint) (*models.User, error)
+	CreateUser(user *models.User) error
+	UpdateUser(user *models.User) error
+	DeleteUser(user *models.User) error
+	SetPreviewPhoto(userID uint, photoID uint) error
+	SaveLocation(username string, lat float32, lon float32) error
+	GetUsersWhoLikedMe(userID uint) ([]models.User, error)
+	GetFeedCandidates(userID uint, role string, limit int) ([]models.User, error)
+	TouchLastActive(userID uint, at time.Time) error
+	SetBoostedUntil(userID uint, until time.Time) error
+	AddUserInteraction(interaction *models.UserInteraction) error
+	GetUserInteraction(userID, targetID uint) (*models.UserInteraction, error)
+	GetUserInteractionsCount(userID uint) (int64, error)
+	GetUserInteractions(userID uint) ([]models.UserInteraction, error)
+	GetLastUserInteraction(userID uint) (*models.UserInteraction, error)
+	DeleteUserInteraction(interaction *models.UserInteraction) error
+	UserIsExists(username string, email string) (bool, error)
+	GetUserByHash(hash string) (*models.User, error)
+	GetUserByEmailChangeHash(hash string) (*models.User, error)
+	GetAllUsers(limit int, page int) ([]models.User, error)
+	GetUsersCount() (int, error)
+	IsExistsEmail(email string) (bool, error)
+	GetUserByEmail(email string) (*models.User, error)
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	GetLinkedIdentity(provider string, subject string) (*models.LinkedIdentity, error)
+	CreateLinkedIdentity(identity *models.LinkedIdentity) error
+	GetDiscoveryPreferences(user *models.User) (*models.DiscoveryPreferences, error)
+	SaveDiscoveryPreferences(prefs *models.DiscoveryPreferences) error
+}
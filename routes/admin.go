@@ -4,29 +4,46 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ilyaDyb/go_rest_api/config"
 	"github.com/ilyaDyb/go_rest_api/controller"
+	"github.com/ilyaDyb/go_rest_api/middleware"
+	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/ilyaDyb/go_rest_api/repository"
 	"github.com/ilyaDyb/go_rest_api/service"
 )
 
 func AdminRoute(route *gin.Engine) {
 	adminGroup := route.Group("/admin")
+	adminGroup.Use(middleware.JWTAuthMiddleware())
 	db := config.DB
 
 	adminRepo := repository.NewPostgresUserRepo(db)
 	chatRepo := repository.NewPostgresChatRepo(db)
+	moderationRepo := repository.NewPostgresModerationRepo(db)
+	subscriptionRepo := repository.NewPostgresSubscriptionRepo(db)
 
 	adminService := service.NewUserService(adminRepo)
 	chatService := service.NewChatService(chatRepo)
+	moderationService := service.NewModerationService(moderationRepo)
+	subscriptionService := service.NewSubscriptionService(subscriptionRepo)
 
-	adminController := controller.NewAdminController(adminService, chatService)
+	adminController := controller.NewAdminController(adminService, chatService, moderationService, subscriptionService)
 	{
-		adminGroup.GET("/users", adminController.UsersList)
-		adminGroup.GET("/user/:id", adminController.GetUser)
-		adminGroup.POST("/user", adminController.CreateUser)
-		adminGroup.PUT("/user/:id", adminController.UpdateUser)
-		adminGroup.DELETE("/user/:id", adminController.DeleteUser)
+		adminGroup.GET("/users", middleware.RequirePermission(models.PermUsersRead), adminController.UsersList)
+		adminGroup.GET("/user/:id", middleware.RequirePermission(models.PermUsersRead), adminController.GetUser)
+		adminGroup.POST("/user", middleware.RequirePermission(models.PermUsersWrite), adminController.CreateUser)
+		adminGroup.PUT("/user/:id", middleware.RequirePermission(models.PermUsersWrite), adminController.UpdateUser)
+		adminGroup.DELETE("/user/:id", middleware.RequirePermission(models.PermUsersWrite), adminController.DeleteUser)
+		adminGroup.GET("/user/:id/subscriptions", middleware.RequirePermission(models.PermUsersRead), adminController.GetUserSubscriptions)
+		adminGroup.POST("/user/:id/subscription", middleware.RequirePermission(models.PermSubscriptionsWrite), adminController.GrantSubscription)
+		adminGroup.DELETE("/user/:id/subscription", middleware.RequirePermission(models.PermSubscriptionsWrite), adminController.RevokeSubscription)
 		
 		// adminGroup
-		adminGroup.GET("/chats", adminController.GetAllChats)
+		adminGroup.GET("/chats", middleware.RequirePermission(models.PermChatsRead), adminController.GetAllChats)
+		adminGroup.GET("/chats/:id/messages", middleware.RequirePermission(models.PermChatsRead), adminController.GetChatMessages)
+
+		adminGroup.GET("/reports", middleware.RequirePermission(models.PermReportsRead), adminController.ReportsQueue)
+		adminGroup.GET("/reports/:id", middleware.RequirePermission(models.PermReportsRead), adminController.GetReport)
+		adminGroup.PATCH("/reports/:id", middleware.RequirePermission(models.PermReportsWrite), adminController.ResolveReport)
+
+		adminGroup.PUT("/settings/two-factor", middleware.RequirePermission(models.PermSettingsWrite), adminController.SetTwoFactorPolicy)
 	}
 }
\ No newline at end of file
@@ -3,7 +3,9 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
 	"github.com/ilyaDyb/go_rest_api/controller"
+	"github.com/ilyaDyb/go_rest_api/middleware"
 	"github.com/ilyaDyb/go_rest_api/repository"
 	"github.com/ilyaDyb/go_rest_api/service"
 )
@@ -12,14 +14,34 @@ func AuthRoute(router *gin.Engine) {
 	authGroup := router.Group("/auth")
 	db := config.DB
 	authRepo := repository.NewPostgresUserRepo(db)
+	sessionRepo := repository.NewRedisSessionRepo(redis.RedisClient)
 	authService := service.NewUserService(authRepo)
-	authController := controller.NewAuthController(authService)
+	sessionService := service.NewSessionService(sessionRepo)
+	authController := controller.NewAuthController(authService, sessionService)
+	router.GET("/.well-known/jwks.json", authController.JWKSController)
 	{
 		authGroup.POST("/registration", authController.RegistrationController)
 		authGroup.POST("/login", authController.LoginController)
 		authGroup.GET("/confirm", authController.ConfirmEmailController)
+		authGroup.POST("/resend-confirmation", authController.ResendConfirmationController)
+		authGroup.GET("/confirm-email-change", authController.ConfirmEmailChangeController)
+		authGroup.POST("/magic-link", authController.RequestMagicLinkController)
+		authGroup.GET("/magic-link/verify", authController.VerifyMagicLinkController)
 		authGroup.POST("/refresh", authController.RefreshController)
 		authGroup.POST("/drop-password", authController.DropPasswordController)
 		authGroup.POST("/change-password", authController.ChangePassword)
+
+		authGroup.GET("/oauth/:provider", authController.OAuthLoginController)
+		authGroup.GET("/oauth/:provider/callback", authController.OAuthCallbackController)
+		authGroup.POST("/login/2fa", authController.LoginTwoFactorController)
+		authGroup.POST("/login/2fa/enroll", authController.LoginEnrollTwoFactorController)
+		authGroup.POST("/2fa/enroll", middleware.JWTAuthMiddleware(), authController.EnrollTwoFactorController)
+		authGroup.POST("/2fa/activate", middleware.JWTAuthMiddleware(), authController.ActivateTwoFactorController)
+		authGroup.POST("/2fa/disable", middleware.JWTAuthMiddleware(), authController.DisableTwoFactorController)
+
+		authGroup.POST("/logout", middleware.JWTAuthMiddleware(), authController.LogoutController)
+		authGroup.POST("/logout-all", middleware.JWTAuthMiddleware(), authController.LogoutAllController)
+		authGroup.GET("/sessions", middleware.JWTAuthMiddleware(), authController.SessionsController)
+		authGroup.DELETE("/sessions/:id", middleware.JWTAuthMiddleware(), authController.RevokeSessionController)
 	}
-}
\ No newline at end of file
+}
@@ -14,17 +14,27 @@ func ChatRoute(router *gin.Engine) {
 
 	userRepo := repository.NewPostgresUserRepo(db)
 	chatRepo := repository.NewPostgresChatRepo(db)
+	moderationRepo := repository.NewPostgresModerationRepo(db)
 
 	userService := service.NewUserService(userRepo)
 	chatService := service.NewChatService(chatRepo)
+	searchService := service.NewSearchService(repository.NewMessageSearcher(db))
+	moderationService := service.NewModerationService(moderationRepo)
 	
-	chatController := controller.NewChatController(chatService, userService)
+	chatController := controller.NewChatController(chatService, userService, searchService, moderationService)
 
 	chatGroup := router.Group("/chats")
 	chatGroup.Use(middleware.JWTAuthMiddleware())
 	{
 		chatGroup.GET("", chatController.GetChatsForSpecUser)
+		chatGroup.GET("/search", chatController.SearchMessagesController)
 		chatGroup.GET("/:username", chatController.ChatController)
 		chatGroup.POST("/message", chatController.SendMessage)
+		chatGroup.POST("/read", chatController.MarkReadController)
+		chatGroup.POST("/unmatch", chatController.UnmatchController)
+		chatGroup.PATCH("/message/:id", chatController.EditMessageController)
+		chatGroup.DELETE("/message/:id", chatController.DeleteMessageController)
+		chatGroup.POST("/attachments", chatController.UploadAttachmentController)
+		chatGroup.GET("/attachments/:id", chatController.GetAttachmentController)
 	}
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/controller"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+)
+
+// PaymentRoute has no JWT auth, webhooks are verified by the provider's signature.
+func PaymentRoute(router *gin.Engine) {
+	subscriptionRepo := repository.NewPostgresSubscriptionRepo(config.DB)
+	subscriptionService := service.NewSubscriptionService(subscriptionRepo)
+	paymentController := controller.NewPaymentController(subscriptionService)
+
+	router.POST("/payments/webhook/:provider", paymentController.WebhookController)
+}
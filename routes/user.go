@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
 	"github.com/ilyaDyb/go_rest_api/controller"
 	"github.com/ilyaDyb/go_rest_api/middleware"
 	"github.com/ilyaDyb/go_rest_api/repository"
@@ -25,11 +26,19 @@ func UserRoute(router *gin.Engine) {
 
 	userRepo := repository.NewPostgresUserRepo(db)
 	chatRepo := repository.NewPostgresChatRepo(db)
+	sessionRepo := repository.NewRedisSessionRepo(redis.RedisClient)
+	moderationRepo := repository.NewPostgresModerationRepo(db)
+	quotaRepo := repository.NewRedisQuotaRepo(redis.RedisClient)
+	subscriptionRepo := repository.NewPostgresSubscriptionRepo(db)
 
 	userService := service.NewUserService(userRepo)
 	chatService := service.NewChatService(chatRepo)
+	sessionService := service.NewSessionService(sessionRepo)
+	moderationService := service.NewModerationService(moderationRepo)
+	quotaService := service.NewQuotaService(quotaRepo)
+	subscriptionService := service.NewSubscriptionService(subscriptionRepo)
 
-	userController := controller.NewUserController(userService, chatService)
+	userController := controller.NewUserController(userService, chatService, sessionService, moderationService, quotaService, subscriptionService)
 
 	authorized := router.Group("/u")
 	authorized.Use(middleware.JWTAuthMiddleware())
@@ -41,6 +50,22 @@ func UserRoute(router *gin.Engine) {
 		authorized.PATCH("/set-coordinates", userController.SetCoordinatesController)
 		authorized.GET("/liked-by-users", userController.LikedByUsersController)
 		authorized.POST("/grade", userController.GradeProfileController)
+		authorized.POST("/rewind", userController.RewindController)
+		authorized.GET("/quotas", userController.QuotasController)
+		authorized.POST("/boost", userController.BoostController)
+		authorized.GET("/subscription", userController.SubscriptionController)
 		authorized.GET("/get-profiles", userController.GetProfilesController)
+		authorized.POST("/change-email", userController.ChangeEmailController)
+		authorized.DELETE("/change-email", userController.CancelEmailChangeController)
+		authorized.POST("/deactivate", userController.DeactivateAccountController)
+		authorized.POST("/delete", userController.DeleteAccountController)
+		authorized.POST("/export", userController.ExportDataController)
+		authorized.PATCH("/privacy", userController.PrivacyController)
+		authorized.GET("/discovery-preferences", userController.GetDiscoveryPreferencesController)
+		authorized.PUT("/discovery-preferences", userController.UpdateDiscoveryPreferencesController)
+		authorized.GET("/blocks", userController.BlockedUsersController)
+		authorized.POST("/block", userController.BlockUserController)
+		authorized.DELETE("/block/:user_id", userController.UnblockUserController)
+		authorized.POST("/report", userController.ReportUserController)
 	}
-}
\ No newline at end of file
+}
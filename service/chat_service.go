@@ -1,17 +1,31 @@
 package service
 
 import (
+	"errors"
+	"time"
+
 	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/ilyaDyb/go_rest_api/repository"
 	"github.com/ilyaDyb/go_rest_api/utils"
 )
 
+const (
+	MessageEditWindow   = 15 * time.Minute
+	MessageUnsendWindow = time.Hour
+)
+
+var (
+	ErrNotMessageSender  = errors.New("only the sender can change the message")
+	ErrMessageDeleted    = errors.New("message was deleted")
+	ErrEditWindowExpired = errors.New("message is too old to be changed")
+)
+
 type ChatService struct {
-    repo repository.ChatRepo
+	repo repository.ChatRepo
 }
- 
+
 func NewChatService(repo repository.ChatRepo) ChatService {
-    return ChatService{repo: repo}
+	return ChatService{repo: repo}
 }
 
 func (s *ChatService) CreateChat(chat *models.Chat) error {
@@ -22,6 +36,29 @@ func (s *ChatService) CreateMessage(message *models.Message) error {
 	return s.repo.CreateMessage(message)
 }
 
+// CreateMessageOnce makes retries of the same client message idempotent: when the
+// message with the same ClientMsgID was already stored, it is loaded into message
+// and created is false.
+func (s *ChatService) CreateMessageOnce(message *models.Message) (bool, error) {
+	if message.ClientMsgID == nil {
+		return true, s.repo.CreateMessage(message)
+	}
+	if existing, err := s.repo.GetMessageByClientMsgID(message.SenderID, *message.ClientMsgID); err == nil {
+		*message = *existing
+		return false, nil
+	}
+	if err := s.repo.CreateMessage(message); err != nil {
+		// concurrent retry could win the race, the unique index keeps only one of them
+		existing, getErr := s.repo.GetMessageByClientMsgID(message.SenderID, *message.ClientMsgID)
+		if getErr != nil {
+			return false, err
+		}
+		*message = *existing
+		return false, nil
+	}
+	return true, nil
+}
+
 func (s *ChatService) GetAllChats() (*[]models.Chat, error) {
 	return s.repo.GetAllChats()
 }
@@ -30,8 +67,78 @@ func (s *ChatService) GetChatByUsernames(username1, username2 string) (*models.C
 	return s.repo.GetChatByUsernames(username1, username2)
 }
 
-func (s *ChatService) GetMessagesByIDChat(chatID uint) (*[]models.Message, error) {
-	return s.repo.GetMessagesByIDChat(chatID)
+func (s *ChatService) GetChatByID(chatID uint) (*models.Chat, error) {
+	return s.repo.GetChatByID(chatID)
+}
+
+func (s *ChatService) GetChatPartnerIDs(userID uint) ([]uint, error) {
+	return s.repo.GetChatPartnerIDs(userID)
+}
+
+// CloseChat closes the chats between the users on unmatch or block and returns them.
+func (s *ChatService) CloseChat(userID uint, otherID uint) ([]models.Chat, error) {
+	return s.repo.CloseChat(userID, otherID, time.Now())
+}
+
+func (s *ChatService) GetMessagesByIDChat(chatID uint, viewerID uint, page repository.MessagePage) (*[]models.Message, bool, error) {
+	return s.repo.GetMessagesByIDChat(chatID, viewerID, page)
+}
+
+func (s *ChatService) GetMessagesForModeration(chatID uint) (*[]models.Message, error) {
+	return s.repo.GetMessagesForModeration(chatID)
+}
+
+func (s *ChatService) GetMessageByID(messageID uint) (*models.Message, error) {
+	return s.repo.GetMessageByID(messageID)
+}
+
+func (s *ChatService) GetMessagesByIDs(messageIDs []uint) ([]models.Message, error) {
+	return s.repo.GetMessagesByIDs(messageIDs)
+}
+
+func (s *ChatService) GetAttachmentByID(attachmentID uint) (*models.Attachment, error) {
+	return s.repo.GetAttachmentByID(attachmentID)
+}
+
+// EditMessage changes the content and keeps the previous one in the history,
+// only the sender can edit and only within MessageEditWindow.
+func (s *ChatService) EditMessage(message *models.Message, editorID uint, content string) error {
+	if message.SenderID != editorID {
+		return ErrNotMessageSender
+	}
+	if message.DeletedForEveryoneAt != nil {
+		return ErrMessageDeleted
+	}
+	if time.Since(message.CreatedAt) > MessageEditWindow {
+		return ErrEditWindowExpired
+	}
+	edit := models.MessageEdit{MessageID: message.ID, OldContent: message.Content}
+	now := time.Now()
+	message.Content = content
+	message.EditedAt = &now
+	return s.repo.EditMessage(message, &edit)
+}
+
+// DeleteMessageForEveryone leaves a tombstone for both members, only the sender
+// can do it and only within MessageUnsendWindow.
+func (s *ChatService) DeleteMessageForEveryone(message *models.Message, userID uint) error {
+	if message.SenderID != userID {
+		return ErrNotMessageSender
+	}
+	if message.DeletedForEveryoneAt != nil {
+		return nil
+	}
+	if time.Since(message.CreatedAt) > MessageUnsendWindow {
+		return ErrEditWindowExpired
+	}
+	now := time.Now()
+	message.DeletedForEveryoneAt = &now
+	return s.repo.DeleteMessageForEveryone(message)
+}
+
+// DeleteMessageForMe hides the message only for the user, any member can do it at any time.
+func (s *ChatService) DeleteMessageForMe(message *models.Message, userID uint) error {
+	return s.repo.HideMessage(message.ID, userID)
 }
 
 func (s *ChatService) GetUserChats(userID uint) (*[]utils.ChatsListResponse, error) {
@@ -40,4 +147,16 @@ func (s *ChatService) GetUserChats(userID uint) (*[]utils.ChatsListResponse, err
 
 func (s *ChatService) GetLastMessageByChatID(chatID uint) (*models.Message, error) {
 	return s.repo.GetLastMessageByChatID(chatID)
-}
\ No newline at end of file
+}
+
+func (s *ChatService) GetUserMessages(userID uint) (*[]models.Message, error) {
+	return s.repo.GetUserMessages(userID)
+}
+
+func (s *ChatService) GetUserMessagesAfter(userID uint, afterID uint, overlap time.Duration, limit int) (*[]models.Message, error) {
+	return s.repo.GetUserMessagesAfter(userID, afterID, overlap, limit)
+}
+
+func (s *ChatService) MarkMessagesRead(chatID uint, readerID uint, upToID uint, readAt time.Time) (int64, error) {
+	return s.repo.MarkMessagesRead(chatID, readerID, upToID, readAt)
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	config.ConnectTestDB()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+)
+
+type ModerationService struct {
+	repo repository.ModerationRepo
+}
+
+func NewModerationService(repo repository.ModerationRepo) ModerationService {
+	return ModerationService{repo: repo}
+}
+
+func (s *ModerationService) CreateBlock(block *models.Block) error {
+	return s.repo.CreateBlock(block)
+}
+
+func (s *ModerationService) DeleteBlock(blockerID uint, blockedID uint) error {
+	return s.repo.DeleteBlock(blockerID, blockedID)
+}
+
+func (s *ModerationService) GetBlocks(blockerID uint) ([]models.Block, error) {
+	return s.repo.GetBlocks(blockerID)
+}
+
+func (s *ModerationService) IsBlocked(userID uint, otherID uint) (bool, error) {
+	return s.repo.IsBlocked(userID, otherID)
+}
+
+func (s *ModerationService) CreateReport(report *models.Report) error {
+	return s.repo.CreateReport(report)
+}
+
+func (s *ModerationService) GetReports(status string, limit int, offset int) ([]models.Report, error) {
+	return s.repo.GetReports(status, limit, offset)
+}
+
+func (s *ModerationService) GetReportsCount(status string) (int64, error) {
+	return s.repo.GetReportsCount(status)
+}
+
+func (s *ModerationService) GetReportByID(reportID uint) (*models.Report, error) {
+	return s.repo.GetReportByID(reportID)
+}
+
+func (s *ModerationService) UpdateReport(report *models.Report) error {
+	return s.repo.UpdateReport(report)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+)
+
+const (
+	QuotaLikes      = "likes"
+	QuotaSuperlikes = "superlikes"
+	QuotaRewinds    = "rewinds"
+	QuotaBoosts     = "boosts"
+)
+
+var QuotaActions = []string{QuotaLikes, QuotaSuperlikes, QuotaRewinds, QuotaBoosts}
+
+var ErrQuotaExceeded = errors.New("daily limit reached")
+
+// Quota is the usage of a limited action today, Limit and Remaining are
+// config.Unlimited for unlimited actions.
+type Quota struct {
+	Action    string    `json:"action"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// QuotaService counts limited actions per day, days start at midnight in the
+// user's timezone.
+type QuotaService struct {
+	repo repository.QuotaRepo
+}
+
+func NewQuotaService(repo repository.QuotaRepo) QuotaService {
+	return QuotaService{repo: repo}
+}
+
+func limitOf(limits config.PlanLimits, action string) int64 {
+	switch action {
+	case QuotaLikes:
+		if limits.Has(models.EntitlementUnlimitedLikes) {
+			return config.Unlimited
+		}
+		return limits.DailyLikes
+	case QuotaSuperlikes:
+		return limits.DailySuperlikes
+	case QuotaRewinds:
+		return limits.DailyRewinds
+	case QuotaBoosts:
+		return limits.DailyBoosts
+	}
+	return 0
+}
+
+// day returns the counter key of the user's current day and when the day ends.
+func day(user *models.User, action string) (string, time.Time) {
+	now := time.Now().In(user.Location())
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return fmt.Sprintf("%s:%d:%s", action, user.ID, start.Format(time.DateOnly)), start.AddDate(0, 0, 1)
+}
+
+func newQuota(action string, limit int64, used int64, resetAt time.Time) *Quota {
+	quota := &Quota{Action: action, Limit: limit, Used: used, Remaining: config.Unlimited, ResetAt: resetAt}
+	if limit != config.Unlimited {
+		quota.Remaining = max(limit-used, 0)
+	}
+	return quota
+}
+
+// Use counts one action of the user, it returns ErrQuotaExceeded together with
+// the quota when today's limit of the plan is already used.
+func (s *QuotaService) Use(user *models.User, plan string, action string) (*Quota, error) {
+	limit := limitOf(config.LimitsOf(plan), action)
+	key, resetAt := day(user, action)
+	used, err := s.repo.Incr(key, resetAt)
+	if err != nil {
+		return nil, err
+	}
+	if limit != config.Unlimited && used > limit {
+		if err := s.repo.Decr(key); err != nil {
+			return nil, err
+		}
+		return newQuota(action, limit, limit, resetAt), ErrQuotaExceeded
+	}
+	return newQuota(action, limit, used, resetAt), nil
+}
+
+// Refund gives back an action which was counted but could not be completed.
+func (s *QuotaService) Refund(user *models.User, action string) error {
+	key, _ := day(user, action)
+	return s.repo.Decr(key)
+}
+
+// Quotas returns today's usage of all limited actions.
+func (s *QuotaService) Quotas(user *models.User, plan string) ([]Quota, error) {
+	limits := config.LimitsOf(plan)
+	quotas := make([]Quota, 0, len(QuotaActions))
+	for _, action := range QuotaActions {
+		key, resetAt := day(user, action)
+		used, err := s.repo.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, *newQuota(action, limitOf(limits, action), used, resetAt))
+	}
+	return quotas, nil
+}
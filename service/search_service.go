@@ -0,0 +1,18 @@
+package service
+
+import (
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/utils"
+)
+
+type SearchService struct {
+	searcher repository.MessageSearcher
+}
+
+func NewSearchService(searcher repository.MessageSearcher) SearchService {
+	return SearchService{searcher: searcher}
+}
+
+func (s *SearchService) SearchMessages(userID uint, query string, limit int) (*[]utils.MessageSearchResponse, error) {
+	return s.searcher.SearchMessages(userID, query, limit)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+)
+
+type SessionService struct {
+	repo repository.SessionRepo
+}
+
+func NewSessionService(repo repository.SessionRepo) SessionService {
+	return SessionService{repo: repo}
+}
+
+func (s *SessionService) CreateSession(session *models.Session, ttl time.Duration) error {
+	return s.repo.CreateSession(session, ttl)
+}
+
+func (s *SessionService) UpdateSession(session *models.Session, ttl time.Duration) error {
+	return s.repo.UpdateSession(session, ttl)
+}
+
+// RotateSession saves the new refresh id of the session if the client used the
+// current one, repository.ErrRefreshTokenReused means it was already rotated.
+func (s *SessionService) RotateSession(session *models.Session, refreshID string, ttl time.Duration) error {
+	return s.repo.RotateSession(session, refreshID, ttl)
+}
+
+func (s *SessionService) GetSession(sessionID string) (*models.Session, error) {
+	return s.repo.GetSession(sessionID)
+}
+
+func (s *SessionService) GetUserSessions(username string) ([]models.Session, error) {
+	return s.repo.GetUserSessions(username)
+}
+
+func (s *SessionService) DeleteSession(session *models.Session) error {
+	return s.repo.DeleteSession(session)
+}
+
+func (s *SessionService) DeleteUserSessions(username string) error {
+	return s.repo.DeleteUserSessions(username)
+}
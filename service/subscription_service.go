@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/api"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownPlan         = errors.New("unknown plan")
+	ErrInvalidPaymentEvent = errors.New("invalid payment event")
+)
+
+type SubscriptionService struct {
+	repo repository.SubscriptionRepo
+}
+
+func NewSubscriptionService(repo repository.SubscriptionRepo) SubscriptionService {
+	return SubscriptionService{repo: repo}
+}
+
+// GetActiveSubscription returns nil when the user has no active subscription.
+func (s *SubscriptionService) GetActiveSubscription(userID uint) (*models.Subscription, error) {
+	subscription, err := s.repo.GetActiveSubscription(userID, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return subscription, err
+}
+
+// PlanOf is the plan of the active subscription, config.PlanFree without one.
+func (s *SubscriptionService) PlanOf(userID uint) (string, error) {
+	subscription, err := s.GetActiveSubscription(userID)
+	if err != nil {
+		return config.PlanFree, err
+	}
+	if subscription == nil {
+		return config.PlanFree, nil
+	}
+	return subscription.Plan, nil
+}
+
+func (s *SubscriptionService) HasEntitlement(userID uint, entitlement string) (bool, error) {
+	plan, err := s.PlanOf(userID)
+	if err != nil {
+		return false, err
+	}
+	return config.LimitsOf(plan).Has(entitlement), nil
+}
+
+func (s *SubscriptionService) GetSubscriptions(userID uint) ([]models.Subscription, error) {
+	return s.repo.GetSubscriptions(userID)
+}
+
+// Grant gives the user the plan for the duration instead of the earlier grants,
+// paid subscriptions are kept and the best active plan applies.
+func (s *SubscriptionService) Grant(userID uint, plan string, duration time.Duration, adminID uint) (*models.Subscription, error) {
+	if !config.IsValidPlan(plan) || plan == config.PlanFree {
+		return nil, ErrUnknownPlan
+	}
+	now := time.Now()
+	subscription := models.Subscription{
+		UserID:      userID,
+		Plan:        plan,
+		Provider:    models.SubscriptionProviderAdmin,
+		ExpiresAt:   now.Add(duration),
+		GrantedByID: &adminID,
+	}
+	if err := s.repo.GrantSubscription(&subscription, now); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// Revoke ends all active subscriptions of the user, billing at the provider is not
+// touched but its webhooks don't reactivate them.
+func (s *SubscriptionService) Revoke(userID uint) error {
+	return s.repo.CancelSubscriptions(userID, time.Now())
+}
+
+// ApplyPaymentEvent applies a verified webhook event of the provider,
+// repository.ErrPaymentEventProcessed means the event was applied before.
+func (s *SubscriptionService) ApplyPaymentEvent(provider string, event *api.PaymentEvent) error {
+	switch event.Type {
+	case models.PaymentEventSubscriptionActive:
+		if !config.IsValidPlan(event.Plan) || event.Plan == config.PlanFree {
+			return fmt.Errorf("%w: %q", ErrUnknownPlan, event.Plan)
+		}
+		// without the end of the period the subscription would be stored as expired
+		if event.ExpiresAt.IsZero() {
+			return fmt.Errorf("%w: expires_at is required", ErrInvalidPaymentEvent)
+		}
+	case models.PaymentEventSubscriptionCanceled:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidPaymentEvent, event.Type)
+	}
+	return s.repo.ApplyPaymentEvent(&models.PaymentEvent{
+		Provider:       provider,
+		EventID:        event.ID,
+		Type:           event.Type,
+		UserID:         event.UserID,
+		Plan:           event.Plan,
+		SubscriptionID: event.SubscriptionID,
+		ExpiresAt:      event.ExpiresAt,
+	}, time.Now())
+}
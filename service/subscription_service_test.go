@@ -0,0 +1,148 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/api"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSubscriber creates a user with its own subscription service.
+func newSubscriber(t *testing.T, username string) (SubscriptionService, uint) {
+	t.Helper()
+	user := models.User{Username: username, Email: username + "@example.com", IsActive: true}
+	require.NoError(t, config.DB.Create(&user).Error)
+	return NewSubscriptionService(repository.NewPostgresSubscriptionRepo(config.DB)), user.ID
+}
+
+func activeEvent(id string, userID uint, subscriptionID string, plan string, expiresAt time.Time) *api.PaymentEvent {
+	return &api.PaymentEvent{
+		ID:             id,
+		Type:           models.PaymentEventSubscriptionActive,
+		UserID:         userID,
+		Plan:           plan,
+		SubscriptionID: subscriptionID,
+		ExpiresAt:      expiresAt,
+	}
+}
+
+func canceledEvent(id string, userID uint, subscriptionID string) *api.PaymentEvent {
+	return &api.PaymentEvent{
+		ID:             id,
+		Type:           models.PaymentEventSubscriptionCanceled,
+		UserID:         userID,
+		SubscriptionID: subscriptionID,
+	}
+}
+
+func assertPlan(t *testing.T, s SubscriptionService, userID uint, want string) {
+	t.Helper()
+	plan, err := s.PlanOf(userID)
+	require.NoError(t, err)
+	assert.Equal(t, want, plan)
+}
+
+func TestApplyPaymentEventIsIdempotent(t *testing.T) {
+	s, userID := newSubscriber(t, "sub_replay")
+	event := activeEvent("replay_1", userID, "replay_sub", config.PlanPlus, time.Now().Add(30*24*time.Hour))
+
+	require.NoError(t, s.ApplyPaymentEvent("fake", event))
+	assert.ErrorIs(t, s.ApplyPaymentEvent("fake", event), repository.ErrPaymentEventProcessed)
+
+	subscriptions, err := s.GetSubscriptions(userID)
+	require.NoError(t, err)
+	assert.Len(t, subscriptions, 1)
+	assertPlan(t, s, userID, config.PlanPlus)
+
+	// the same event id of another provider is another event
+	require.NoError(t, s.ApplyPaymentEvent("other", event))
+}
+
+func TestApplyPaymentEventOutOfOrder(t *testing.T) {
+	s, userID := newSubscriber(t, "sub_order")
+	now := time.Now()
+	firstPeriod, secondPeriod := now.Add(30*24*time.Hour), now.Add(60*24*time.Hour)
+
+	// the renewal arrives before the first payment
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("order_2", userID, "order_sub", config.PlanPremium, secondPeriod)))
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("order_1", userID, "order_sub", config.PlanPlus, firstPeriod)))
+	subscription, err := s.GetActiveSubscription(userID)
+	require.NoError(t, err)
+	require.NotNil(t, subscription)
+	assert.WithinDuration(t, secondPeriod, subscription.ExpiresAt, time.Second)
+	assert.Equal(t, config.PlanPremium, subscription.Plan)
+
+	// a late event of the current period doesn't undo the cancellation
+	require.NoError(t, s.ApplyPaymentEvent("fake", canceledEvent("order_3", userID, "order_sub")))
+	assertPlan(t, s, userID, config.PlanFree)
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("order_4", userID, "order_sub", config.PlanPremium, secondPeriod)))
+	assertPlan(t, s, userID, config.PlanFree)
+
+	// renewing for the next period does
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("order_5", userID, "order_sub", config.PlanPremium, now.Add(90*24*time.Hour))))
+	assertPlan(t, s, userID, config.PlanPremium)
+}
+
+func TestApplyPaymentEventValidation(t *testing.T) {
+	s, userID := newSubscriber(t, "sub_invalid")
+
+	err := s.ApplyPaymentEvent("fake", activeEvent("invalid_1", userID, "invalid_sub", config.PlanPlus, time.Time{}))
+	assert.ErrorIs(t, err, ErrInvalidPaymentEvent)
+	err = s.ApplyPaymentEvent("fake", activeEvent("invalid_2", userID, "invalid_sub", config.PlanFree, time.Now().Add(time.Hour)))
+	assert.ErrorIs(t, err, ErrUnknownPlan)
+	err = s.ApplyPaymentEvent("fake", &api.PaymentEvent{ID: "invalid_3", Type: "subscription.paused", UserID: userID, SubscriptionID: "invalid_sub"})
+	assert.ErrorIs(t, err, ErrInvalidPaymentEvent)
+
+	subscriptions, err := s.GetSubscriptions(userID)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+}
+
+func TestGrantAndRevoke(t *testing.T) {
+	s, userID := newSubscriber(t, "sub_grant")
+	expiresAt := time.Now().Add(30 * 24 * time.Hour)
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("grant_1", userID, "grant_sub", config.PlanPlus, expiresAt)))
+
+	_, err := s.Grant(userID, config.PlanFree, time.Hour, 1)
+	assert.ErrorIs(t, err, ErrUnknownPlan)
+
+	earlier, err := s.Grant(userID, config.PlanPremium, time.Hour, 1)
+	require.NoError(t, err)
+	granted, err := s.Grant(userID, config.PlanPremium, 7*24*time.Hour, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionProviderAdmin, granted.Provider)
+	// the better plan applies although the paid subscription lasts longer
+	subscription, err := s.GetActiveSubscription(userID)
+	require.NoError(t, err)
+	assert.Equal(t, granted.ID, subscription.ID)
+
+	// the grant replaced only the earlier grant, the paid subscription keeps renewing
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("grant_2", userID, "grant_sub", config.PlanPlus, expiresAt.Add(30*24*time.Hour))))
+	subscriptions, err := s.GetSubscriptions(userID)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 3)
+	for _, subscription := range subscriptions {
+		switch subscription.ID {
+		case earlier.ID:
+			assert.NotNil(t, subscription.RevokedAt)
+		default:
+			assert.Nil(t, subscription.RevokedAt)
+			assert.Nil(t, subscription.CanceledAt)
+		}
+	}
+
+	// when the grant is over the paid plan applies again
+	require.NoError(t, config.DB.Model(&models.Subscription{}).Where("id = ?", granted.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	assertPlan(t, s, userID, config.PlanPlus)
+
+	require.NoError(t, s.Revoke(userID))
+	assertPlan(t, s, userID, config.PlanFree)
+	require.NoError(t, s.ApplyPaymentEvent("fake", activeEvent("grant_3", userID, "grant_sub", config.PlanPlus, expiresAt.Add(60*24*time.Hour))))
+	assertPlan(t, s, userID, config.PlanFree)
+}
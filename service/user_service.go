@@ -1,88 +1,149 @@
 package service
 
 import (
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
 	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/ranking"
 	"github.com/ilyaDyb/go_rest_api/repository"
-	"github.com/rosberry/go-pagination"
 )
 
 type UserService struct {
-    repo repository.UserRepo
+	repo repository.UserRepo
 }
- 
+
 func NewUserService(repo repository.UserRepo) UserService {
-    return UserService{repo: repo}
+	return UserService{repo: repo}
 }
 
 func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
-    return s.repo.GetUserByUsername(username)
+	return s.repo.GetUserByUsername(username)
 }
 
 func (s *UserService) GetUserByID(ID uint) (*models.User, error) {
-    return s.repo.GetUserByID(ID)
+	return s.repo.GetUserByID(ID)
 }
 
 func (s *UserService) CreateUser(user *models.User) error {
-    return s.repo.CreateUser(user)
+	return s.repo.CreateUser(user)
 }
 
 func (s *UserService) UpdateUser(user *models.User) error {
-    return s.repo.UpdateUser(user)
+	return s.repo.UpdateUser(user)
 }
 
 func (s *UserService) DeleteUser(user *models.User) error {
-    return s.repo.DeleteUser(user)
+	return s.repo.DeleteUser(user)
 }
 
-
 func (s *UserService) SetPreviewPhoto(userID uint, photoID uint) error {
-    return s.repo.SetPreviewPhoto(userID, photoID)
+	return s.repo.SetPreviewPhoto(userID, photoID)
 }
 
 func (s *UserService) SaveLocation(username string, lat float32, lon float32) error {
-    return s.repo.SaveLocation(username, lat, lon)
+	return s.repo.SaveLocation(username, lat, lon)
 }
 
 func (s *UserService) GetUsersWhoLikedMe(userID uint) ([]models.User, error) {
-    return s.repo.GetUsersWhoLikedMe(userID)
+	return s.repo.GetUsersWhoLikedMe(userID)
+}
+
+// GetFeed ranks the whole candidate pool and returns the requested page of it,
+// total is the size of the pool.
+func (s *UserService) GetFeed(viewer *models.User, role string, ranker ranking.Ranker, offset int, limit int) ([]models.User, int, error) {
+	candidates, err := s.repo.GetFeedCandidates(viewer.ID, role, config.RankingPoolSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	ranked := ranker.Rank(viewer, candidates)
+	if offset >= len(ranked) {
+		return []models.User{}, len(ranked), nil
+	}
+	return ranked[offset:min(offset+limit, len(ranked))], len(ranked), nil
+}
+
+func (s *UserService) TouchLastActive(userID uint) error {
+	return s.repo.TouchLastActive(userID, time.Now())
 }
 
-func (s *UserService) GetUsersList(userID uint, role string, paginator *pagination.Paginator) ([]models.User, error) {
-    return s.repo.GetUsersList(userID, role, paginator)
+func (s *UserService) SetBoostedUntil(userID uint, until time.Time) error {
+	return s.repo.SetBoostedUntil(userID, until)
 }
 
 func (s *UserService) AddUserInteraction(interaction *models.UserInteraction) error {
-    return s.repo.AddUserInteraction(interaction)
+	return s.repo.AddUserInteraction(interaction)
 }
 
 func (s *UserService) GetUserInteraction(userID, targetID uint) (*models.UserInteraction, error) {
-    return s.repo.GetUserInteraction(userID, targetID)
+	return s.repo.GetUserInteraction(userID, targetID)
 }
 
 func (s *UserService) GetUserInteractionsCount(userID uint) (int64, error) {
-    return s.repo.GetUserInteractionsCount(userID)    
+	return s.repo.GetUserInteractionsCount(userID)
+}
+
+func (s *UserService) GetUserInteractions(userID uint) ([]models.UserInteraction, error) {
+	return s.repo.GetUserInteractions(userID)
+}
+
+func (s *UserService) GetLastUserInteraction(userID uint) (*models.UserInteraction, error) {
+	return s.repo.GetLastUserInteraction(userID)
+}
+
+func (s *UserService) DeleteUserInteraction(interaction *models.UserInteraction) error {
+	return s.repo.DeleteUserInteraction(interaction)
 }
 
 func (s *UserService) UserIsExists(username string, email string) (bool, error) {
-    return s.repo.UserIsExists(username, email)
+	return s.repo.UserIsExists(username, email)
 }
 
 func (s *UserService) GetUserByHash(hash string) (*models.User, error) {
-    return s.repo.GetUserByHash(hash)
+	return s.repo.GetUserByHash(hash)
+}
+
+func (s *UserService) GetUserByEmailChangeHash(hash string) (*models.User, error) {
+	return s.repo.GetUserByEmailChangeHash(hash)
 }
 
 func (s *UserService) GetAllUsers(limit int, page int) ([]models.User, error) {
-    return s.repo.GetAllUsers(limit, page)
+	return s.repo.GetAllUsers(limit, page)
 }
 
 func (s *UserService) GetUsersCount() (int, error) {
-    return s.repo.GetUsersCount()
+	return s.repo.GetUsersCount()
 }
 
 func (s *UserService) IsExistsEmail(email string) (bool, error) {
-    return s.repo.IsExistsEmail(email)
+	return s.repo.IsExistsEmail(email)
 }
 
 func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
-    return s.repo.GetUserByEmail(email)
-}
\ No newline at end of file
+	return s.repo.GetUserByEmail(email)
+}
+
+func (s *UserService) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return s.repo.ReplaceRecoveryCodes(userID, codeHashes)
+}
+
+func (s *UserService) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	return s.repo.UseRecoveryCode(userID, codeHash)
+}
+
+func (s *UserService) GetLinkedIdentity(provider string, subject string) (*models.LinkedIdentity, error) {
+	return s.repo.GetLinkedIdentity(provider, subject)
+}
+
+func (s *UserService) CreateLinkedIdentity(identity *models.LinkedIdentity) error {
+	return s.repo.CreateLinkedIdentity(identity)
+}
+
+// GetDiscoveryPreferences returns saved preferences or the defaults.
+func (s *UserService) GetDiscoveryPreferences(user *models.User) (*models.DiscoveryPreferences, error) {
+	return s.repo.GetDiscoveryPreferences(user)
+}
+
+func (s *UserService) SaveDiscoveryPreferences(prefs *models.DiscoveryPreferences) error {
+	return s.repo.SaveDiscoveryPreferences(prefs)
+}
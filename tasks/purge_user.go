@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const TypePurgeUser = "user:purge"
+
+type PurgeUserPayload struct {
+	UserID uint
+}
+
+func NewPurgeUserTask(userID uint) (*asynq.Task, error) {
+	payload, err := json.Marshal(PurgeUserPayload{UserID: userID})
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "asynq",
+		}).Errorf("Failed to start PurgeUserTask with error: %v", err)
+		return nil, err
+	}
+	return asynq.NewTask(TypePurgeUser, payload), nil
+}
+
+// HandlePurgeUserTask hard deletes the user with photos, discovery preferences, chats, messages with
+// their edits and hides, interactions, blocks, reports and subscriptions.
+// The deletion could be cancelled after the task was scheduled, so the task re-checks
+// DeletionScheduledAt and does nothing if it was cleared or moved.
+func HandlePurgeUserTask(ctx context.Context, t *asynq.Task) error {
+	var p PurgeUserPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "asynq",
+		}).Errorf("Failed to unmarchal data with error: %v", err)
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	var user models.User
+	if err := config.DB.Unscoped().Preload("Photo").First(&user, p.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if user.DeletionScheduledAt == nil || user.DeletionScheduledAt.After(time.Now()) {
+		logger.Log.WithFields(logrus.Fields{
+			"service": "asynq",
+			"user_id": user.ID,
+		}).Info("user deletion was cancelled, purge skipped")
+		return nil
+	}
+
+	var attachmentPaths []string
+	config.DB.Unscoped().Model(&models.Attachment{}).
+		Where("message_id IN (SELECT id FROM messages WHERE sender_id = ? OR receiver_id = ?)", user.ID, user.ID).
+		Pluck("path", &attachmentPaths)
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// the session keeps Unscoped but starts every statement with fresh conditions
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		if err := tx.Where("message_id IN (SELECT id FROM messages WHERE sender_id = ? OR receiver_id = ?)", user.ID, user.ID).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM report_messages WHERE report_id IN (SELECT id FROM reports WHERE reporter_id = ? OR reported_id = ?)
+			OR message_id IN (SELECT id FROM messages WHERE sender_id = ? OR receiver_id = ?)`, user.ID, user.ID, user.ID, user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("reporter_id = ? OR reported_id = ?", user.ID, user.ID).Delete(&models.Report{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("blocker_id = ? OR blocked_id = ?", user.ID, user.ID).Delete(&models.Block{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (SELECT id FROM messages WHERE sender_id = ? OR receiver_id = ?)", user.ID, user.ID).Delete(&models.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR message_id IN (SELECT id FROM messages WHERE sender_id = ? OR receiver_id = ?)", user.ID, user.ID, user.ID).Delete(&models.MessageHide{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sender_id = ? OR receiver_id = ?", user.ID, user.ID).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user1_id = ? OR user2_id = ?", user.ID, user.ID).Delete(&models.Chat{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR target_id = ?", user.ID, user.ID).Delete(&models.UserInteraction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Photo{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.DiscoveryPreferences{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.LinkedIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Subscription{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PaymentEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// files are removed after the commit, a failed transaction must not lose photos
+	for _, photo := range user.Photo {
+		attachmentPaths = append(attachmentPaths, photo.URL)
+	}
+	for _, path := range attachmentPaths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Log.WithFields(logrus.Fields{
+				"service": "asynq",
+				"user_id": user.ID,
+			}).Errorf("Failed to remove file %v with error: %v", path, err)
+		}
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"service": "asynq",
+		"user_id": user.ID,
+	}).Info("User was purged")
+	return nil
+}
@@ -0,0 +1,70 @@
+package tasks
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	config.ConnectTestDB()
+	os.Exit(m.Run())
+}
+
+// countRows counts rows of the model including soft deleted ones.
+func countRows(t *testing.T, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+	var count int64
+	require.NoError(t, config.DB.Unscoped().Model(model).Where(query, args...).Count(&count).Error)
+	return count
+}
+
+func TestHandlePurgeUserTask(t *testing.T) {
+	db := config.DB
+	scheduledAt := time.Now().Add(-time.Minute)
+	user := models.User{Username: "purge_user", Email: "purge_user@example.com", DeletionScheduledAt: &scheduledAt}
+	other := models.User{Username: "purge_other", Email: "purge_other@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, db.Create(&other).Error)
+
+	chat := models.Chat{User1ID: user.ID, User2ID: other.ID}
+	require.NoError(t, db.Create(&chat).Error)
+	message := models.Message{ChatID: chat.ID, SenderID: user.ID, ReceiverID: other.ID, Content: "edited"}
+	require.NoError(t, db.Create(&message).Error)
+	require.NoError(t, db.Create(&models.MessageEdit{MessageID: message.ID, OldContent: "original"}).Error)
+	require.NoError(t, db.Create(&models.MessageHide{MessageID: message.ID, UserID: other.ID}).Error)
+	prefs := models.DefaultDiscoveryPreferences(&user)
+	require.NoError(t, db.Create(prefs).Error)
+
+	task, err := NewPurgeUserTask(user.ID)
+	require.NoError(t, err)
+	require.NoError(t, HandlePurgeUserTask(context.Background(), task))
+
+	assert.Zero(t, countRows(t, &models.User{}, "id = ?", user.ID))
+	assert.Zero(t, countRows(t, &models.Message{}, "id = ?", message.ID))
+	assert.Zero(t, countRows(t, &models.MessageEdit{}, "message_id = ?", message.ID))
+	assert.Zero(t, countRows(t, &models.MessageHide{}, "message_id = ?", message.ID))
+	assert.Zero(t, countRows(t, &models.DiscoveryPreferences{}, "user_id = ?", user.ID))
+	assert.Equal(t, int64(1), countRows(t, &models.User{}, "id = ?", other.ID))
+}
+
+func TestHandlePurgeUserTaskSkipsCancelledDeletion(t *testing.T) {
+	user := models.User{Username: "purge_cancelled", Email: "purge_cancelled@example.com"}
+	require.NoError(t, config.DB.Create(&user).Error)
+
+	task, err := NewPurgeUserTask(user.ID)
+	require.NoError(t, err)
+	require.NoError(t, HandlePurgeUserTask(context.Background(), task))
+	assert.Equal(t, int64(1), countRows(t, &models.User{}, "id = ?", user.ID))
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LockoutPolicy describes how many failures are tolerated inside Window before the
+// key gets locked. Every next lockout of the same key lasts twice as long as the
+// previous one, up to MaxLock.
+type LockoutPolicy struct {
+	MaxAttempts int64
+	Window      time.Duration
+	BaseLock    time.Duration
+	MaxLock     time.Duration
+}
+
+const lockoutsMemory = 24 * time.Hour
+
+func attemptsKey(key string) string {
+	return "attempts:" + key
+}
+
+func lockKey(key string) string {
+	return "lock:" + key
+}
+
+func lockoutsKey(key string) string {
+	return "lockouts:" + key
+}
+
+// GetLockout returns for how long the key is still locked, zero means it is not locked.
+func GetLockout(rdb *redis.Client, key string) (time.Duration, error) {
+	ttl, err := rdb.PTTL(ctx, lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// RegisterFailedAttempt counts the failure and locks the key once the policy limit is
+// reached. It returns the lock duration if the key was locked by this attempt.
+func RegisterFailedAttempt(rdb *redis.Client, key string, policy LockoutPolicy) (time.Duration, error) {
+	attempts, err := rdb.Incr(ctx, attemptsKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if attempts == 1 {
+		rdb.Expire(ctx, attemptsKey(key), policy.Window)
+	}
+	if attempts < policy.MaxAttempts {
+		return 0, nil
+	}
+
+	lockouts, err := rdb.Incr(ctx, lockoutsKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	rdb.Expire(ctx, lockoutsKey(key), lockoutsMemory)
+
+	duration := policy.BaseLock
+	for i := int64(1); i < lockouts && duration < policy.MaxLock; i++ {
+		duration *= 2
+	}
+	if duration > policy.MaxLock {
+		duration = policy.MaxLock
+	}
+	pipe := rdb.TxPipeline()
+	pipe.Set(ctx, lockKey(key), 1, duration)
+	pipe.Del(ctx, attemptsKey(key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return duration, nil
+}
+
+func ResetAttempts(rdb *redis.Client, key string) error {
+	return rdb.Del(ctx, attemptsKey(key), lockoutsKey(key)).Err()
+}
+
+// AllowRequest is a fixed window rate limiter, it returns false once more than limit
+// requests were made with the key inside the window.
+func AllowRequest(rdb *redis.Client, key string, limit int64, window time.Duration) (bool, error) {
+	count, err := rdb.Incr(ctx, "rate:"+key).Result()
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		rdb.Expire(ctx, "rate:"+key, window)
+	}
+	return count <= limit, nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey is one key of the key set, kid is the name of its PEM file.
+// Keys without private part are kept only to verify tokens issued before rotation.
+type jwtKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+var (
+	activeKey        *jwtKey
+	verificationKeys = map[string]*jwtKey{}
+)
+
+// LoadSigningKeys reads all *.pem files from JWT_KEYS_DIR. RSA keys sign with RS256,
+// Ed25519 keys with EdDSA. JWT_ACTIVE_KID selects the signing key, it may be omitted
+// when there is only one private key. Server must not start if it returns error.
+func LoadSigningKeys() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return errors.New("JWT_KEYS_DIR is not set")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := map[string]*jwtKey{}
+	var privateKeys []*jwtKey
+	for _, file := range files {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return fmt.Errorf("could not load jwt key %s: %w", file, err)
+		}
+		keys[key.ID] = key
+		if key.Private != nil {
+			privateKeys = append(privateKeys, key)
+		}
+	}
+
+	activeKID := os.Getenv("JWT_ACTIVE_KID")
+	var active *jwtKey
+	switch {
+	case activeKID != "":
+		active = keys[activeKID]
+		if active == nil || active.Private == nil {
+			return fmt.Errorf("no private key with kid %s in %s", activeKID, dir)
+		}
+	case len(privateKeys) == 1:
+		active = privateKeys[0]
+	case len(privateKeys) == 0:
+		return fmt.Errorf("no private keys in %s", dir)
+	default:
+		return errors.New("JWT_ACTIVE_KID must be set when there are several private keys")
+	}
+
+	activeKey = active
+	verificationKeys = keys
+	return nil
+}
+
+func loadKeyFile(file string) (*jwtKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("file has no PEM block")
+	}
+	key := &jwtKey{ID: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	if rsaKey, ok := key.Public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, errors.New("RSA key must be at least 2048 bits")
+	}
+	return key, nil
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+	if activeKey == nil {
+		return "", errors.New("jwt signing keys are not loaded")
+	}
+	token := jwt.NewWithClaims(activeKey.Method, claims)
+	token.Header["kid"] = activeKey.ID
+	return token.SignedString(activeKey.Private)
+}
+
+func parseToken(tokenStr string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := verificationKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key.Public, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// JWKS returns public part of all verification keys in RFC 7517 format.
+func JWKS() map[string]interface{} {
+	keys := make([]map[string]string, 0, len(verificationKeys))
+	for _, key := range verificationKeys {
+		jwk := map[string]string{
+			"kid": key.ID,
+			"use": "sig",
+			"alg": key.Method.Alg(),
+		}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func writeEd25519Key(t *testing.T, dir, kid string) ed25519.PrivateKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+	return private
+}
+
+func writePublicKey(t *testing.T, dir, kid string, public interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	writePEM(t, dir, kid, "PUBLIC KEY", der)
+}
+
+func loadKeysFrom(t *testing.T, dir, activeKID string) error {
+	t.Helper()
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_ACTIVE_KID", activeKID)
+	return LoadSigningKeys()
+}
+
+func tokenKID(t *testing.T, tokenStr string) string {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenStr, &Claims{})
+	require.NoError(t, err)
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestLoadSigningKeysRejectsShortRSAKey(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	writePEM(t, dir, "short", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private))
+	err = loadKeysFrom(t, dir, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "at least 2048 bits")
+
+	// a short public key left over from rotation is refused as well
+	dir = t.TempDir()
+	writeEd25519Key(t, dir, "current")
+	writePublicKey(t, dir, "short", &private.PublicKey)
+	assert.Error(t, loadKeysFrom(t, dir, "current"))
+}
+
+func TestLoadSigningKeysPicksActiveKID(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2024-01")
+	writeEd25519Key(t, dir, "2024-02")
+
+	assert.Error(t, loadKeysFrom(t, dir, ""), "several private keys need JWT_ACTIVE_KID")
+	assert.Error(t, loadKeysFrom(t, dir, "missing"))
+
+	require.NoError(t, loadKeysFrom(t, dir, "2024-02"))
+	token, err := GenerateJWT("keys_user", "user", "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02", tokenKID(t, token))
+
+	// a single private key is active without JWT_ACTIVE_KID
+	single := t.TempDir()
+	writeEd25519Key(t, single, "only")
+	require.NoError(t, loadKeysFrom(t, single, ""))
+	token, err = GenerateJWT("keys_user", "user", "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "only", tokenKID(t, token))
+}
+
+func TestRotatedOutKeyStillVerifies(t *testing.T) {
+	before := t.TempDir()
+	old := writeEd25519Key(t, before, "old")
+	require.NoError(t, loadKeysFrom(t, before, ""))
+	oldToken, err := GenerateJWT("keys_user", "user", "session-1")
+	require.NoError(t, err)
+
+	// after rotation only the public part of the old key is kept
+	after := t.TempDir()
+	writeEd25519Key(t, after, "new")
+	writePublicKey(t, after, "old", old.Public())
+	require.NoError(t, loadKeysFrom(t, after, ""))
+
+	claims, err := ParseJWT(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "keys_user", claims.Username)
+
+	newToken, err := GenerateJWT("keys_user", "user", "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "new", tokenKID(t, newToken))
+
+	// once the old key is removed its tokens stop verifying
+	require.NoError(t, os.Remove(filepath.Join(after, "old.pem")))
+	require.NoError(t, loadKeysFrom(t, after, ""))
+	_, err = ParseJWT(oldToken)
+	assert.Error(t, err)
+}
+
+func TestJWKSShape(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	edKey := writeEd25519Key(t, dir, "ed")
+	writePublicKey(t, dir, "rsa", &rsaKey.PublicKey)
+	require.NoError(t, loadKeysFrom(t, dir, "ed"))
+
+	keys, ok := JWKS()["keys"].([]map[string]string)
+	require.True(t, ok)
+	require.Len(t, keys, 2)
+
+	byKID := map[string]map[string]string{}
+	for _, jwk := range keys {
+		byKID[jwk["kid"]] = jwk
+	}
+
+	assert.Equal(t, map[string]string{
+		"kid": "ed",
+		"use": "sig",
+		"alg": "EdDSA",
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)),
+	}, byKID["ed"])
+
+	assert.Equal(t, map[string]string{
+		"kid": "rsa",
+		"use": "sig",
+		"alg": "RS256",
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}, byKID["rsa"])
+	// no private material is published
+	assert.NotContains(t, byKID["rsa"], "d")
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	crypto "crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -34,4 +35,19 @@ func GenerateRandomCode(length int) (string, error) {
         code += fmt.Sprintf("%d", n.Int64())
     }
     return code, nil
-}
\ No newline at end of file
+}
+
+func GetSHA256Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n bytes from crypto/rand as a hex string, it is used for
+// links and states which must not be guessable.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := crypto.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
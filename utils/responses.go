@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"time"
+
 	"github.com/ilyaDyb/go_rest_api/models"
 	"github.com/rosberry/go-pagination"
 )
@@ -34,4 +36,19 @@ type ChatsListResponse struct {
 	LastMessage string `json:"last_message"`
 	IsRead bool `json:"is_read"`
 	SenderUsername string `json:"sender_username"`
-}
\ No newline at end of file
+	UnreadCount int64 `json:"unread_count"`
+	LastMessageAt time.Time `json:"last_message_at"`
+	UserID uint `json:"user_id"`
+	HidePresence bool `json:"-"`
+	Presence *models.Presence `json:"presence,omitempty" gorm:"-"`
+}
+
+// MessageSearchResponse is a message found by /chats/search, Snippet is HTML-escaped
+// and the matched words in it are wrapped with <mark></mark>.
+type MessageSearchResponse struct {
+	ChatID    uint      `json:"chat_id"`
+	MessageID uint      `json:"message_id"`
+	SenderID  uint      `json:"sender_id"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,75 +1,168 @@
 package utils
 
 import (
-	"os"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-var refreshKey = []byte(os.Getenv("REFRESH_SECRET"))
+const (
+	AccessTokenLifetime    = 60 * time.Minute
+	RefreshTokenLifetime   = 7 * 24 * time.Hour
+	ChallengeTokenLifetime = 5 * time.Minute
+	MagicLinkLifetime      = 15 * time.Minute
+)
+
+// All tokens are signed with the same key set, so every token carries its type
+// and a token of one type is never accepted in place of another.
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeRefresh   = "refresh"
+	TokenTypeChallenge = "challenge"
+	TokenTypeMagicLink = "magic_link"
+)
+
+// Purposes of challenge tokens which are issued between login steps.
+const (
+	PurposeTwoFactorLogin  = "2fa_login"
+	PurposeTwoFactorEnroll = "2fa_enroll"
+)
+
+var errWrongTokenType = errors.New("wrong token type")
 
 type Claims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	TokenType string `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
+// RefreshClaims.ID (jti) identifies the refresh token inside its session,
+// it changes on every rotation.
 type RefreshClaims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// ChallengeClaims is a short-lived proof that the first login step (password) has passed.
+type ChallengeClaims struct {
+	Username  string `json:"username"`
+	Purpose   string `json:"purpose"`
+	TokenType string `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
+// MagicLinkClaims.ID (jti) is stored in redis until the link is used,
+// the signature alone doesn't make the link single-use.
+type MagicLinkClaims struct {
+	Username  string `json:"username"`
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
 
-func GenerateJWT(username string) (string, error) {
-	expirationTime := time.Now().Add(60 * time.Minute)
+func GenerateJWT(username string, role string, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenLifetime)
 	claims := &Claims{
-		Username: username,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return signToken(claims)
 }
 
 
-func GenerateRefreshToken(username string) (string, error) {
-	expirationTime := time.Now().Add(7 * 24 * time.Hour)
+func GenerateRefreshToken(username string, sessionID string, refreshID string) (string, error) {
+	expirationTime := time.Now().Add(RefreshTokenLifetime)
 	claims := &RefreshClaims{
-		Username: username,
+		Username:  username,
+		SessionID: sessionID,
+		TokenType: TokenTypeRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        refreshID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+	return signToken(claims)
+}
+
+func GenerateChallengeToken(username string, purpose string) (string, error) {
+	expirationTime := time.Now().Add(ChallengeTokenLifetime)
+	claims := &ChallengeClaims{
+		Username:  username,
+		Purpose:   purpose,
+		TokenType: TokenTypeChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+	return signToken(claims)
+}
+
+func GenerateMagicLinkToken(username string, linkID string) (string, error) {
+	expirationTime := time.Now().Add(MagicLinkLifetime)
+	claims := &MagicLinkClaims{
+		Username:  username,
+		TokenType: TokenTypeMagicLink,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        linkID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(refreshKey)
+	return signToken(claims)
 }
 
 func ParseJWT(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil {
+	if err := parseToken(tokenStr, claims); err != nil {
 		return nil, err
 	}
-	if !token.Valid {
-		return nil, err
+	if claims.TokenType != TokenTypeAccess {
+		return nil, errWrongTokenType
 	}
 	return claims, nil
 }
 
 func ParseRefreshToken(tokenStr string) (*RefreshClaims, error) {
 	claims := &RefreshClaims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		return refreshKey, nil
-	})
-	if err != nil {
+	if err := parseToken(tokenStr, claims); err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeRefresh {
+		return nil, errWrongTokenType
+	}
+	return claims, nil
+}
+
+func ParseChallengeToken(tokenStr string) (*ChallengeClaims, error) {
+	claims := &ChallengeClaims{}
+	if err := parseToken(tokenStr, claims); err != nil {
 		return nil, err
 	}
-	if !token.Valid {
+	if claims.TokenType != TokenTypeChallenge || claims.Purpose == "" {
+		return nil, errWrongTokenType
+	}
+	return claims, nil
+}
+
+func ParseMagicLinkToken(tokenStr string) (*MagicLinkClaims, error) {
+	claims := &MagicLinkClaims{}
+	if err := parseToken(tokenStr, claims); err != nil {
 		return nil, err
 	}
+	if claims.TokenType != TokenTypeMagicLink || claims.ID == "" {
+		return nil, errWrongTokenType
+	}
 	return claims, nil
-}
\ No newline at end of file
+}
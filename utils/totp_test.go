@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, "12345678901234567890".
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, the 6-digit codes are the last digits of the 8-digit ones
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+			assert.True(t, ok)
+			assert.Equal(t, tt.unix/totpPeriod, step)
+		})
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	// the code of the step of 1111111111 from the RFC vectors
+	const code = "050471"
+	step := int64(1111111111) / totpPeriod
+	middle := step*totpPeriod + totpPeriod/2
+	tests := []struct {
+		name string
+		unix int64
+		ok   bool
+	}{
+		{"same step", middle, true},
+		{"one step late", middle + totpPeriod, true},
+		{"one step early", middle - totpPeriod, true},
+		{"two steps late", middle + 2*totpPeriod, false},
+		{"two steps early", middle - 2*totpPeriod, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(tt.unix, 0))
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				// the matched step is returned for the replay guard, not the current one
+				assert.Equal(t, step, matched)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		_, ok := ValidateTOTP(rfc6238Secret, code, now)
+		assert.False(t, ok, code)
+	}
+	_, ok := ValidateTOTP("not base32!", "287082", now)
+	assert.False(t, ok)
+	// secrets are accepted in lower case as authenticator apps show them
+	_, ok = ValidateTOTP(strings.ToLower(rfc6238Secret), "287082", now)
+	assert.True(t, ok)
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+	assert.Len(t, key, 20)
+
+	other, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("TinderClone", "alice", rfc6238Secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/TinderClone:alice", uri.Path)
+	assert.Equal(t, rfc6238Secret, uri.Query().Get("secret"))
+	assert.Equal(t, "TinderClone", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	format := regexp.MustCompile(`^[a-hjkmnp-z2-9]{5}-[a-hjkmnp-z2-9]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Regexp(t, format, code)
+		assert.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+	}
+}
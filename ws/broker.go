@@ -0,0 +1,50 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BrokerMessage is an event addressed to users, every replica receives it and
+// delivers it to the connections it holds.
+type BrokerMessage struct {
+	UserIDs []uint `json:"user_ids"`
+	Event   Event  `json:"event"`
+}
+
+// Broker fans events out between API replicas and keeps presence of users
+// which is shared by all of them.
+type Broker interface {
+	Publish(msg BrokerMessage) error
+	// Subscribe registers the handler for messages published by any replica.
+	Subscribe(handler func(BrokerMessage)) error
+	// SetPresence stores status of the user's connections on this replica,
+	// PresenceOffline means the replica has no connections of the user anymore.
+	SetPresence(userID uint, status string) error
+	// GetPresence aggregates statuses of all replicas: online wins over away.
+	GetPresence(userID uint) (Presence, error)
+	Close() error
+}
+
+// PresenceRefreshPeriod is how often the hub confirms presence of its users.
+const PresenceRefreshPeriod = 30 * time.Second
+
+const (
+	BrokerMemory = "memory"
+	BrokerRedis  = "redis"
+)
+
+// NewBroker creates the broker by its kind, an empty kind means in-memory broker
+// which is enough for a single replica.
+func NewBroker(kind string, rdb *redis.Client) (Broker, error) {
+	switch kind {
+	case "", BrokerMemory:
+		return NewMemoryBroker(), nil
+	case BrokerRedis:
+		return NewRedisBroker(rdb), nil
+	default:
+		return nil, fmt.Errorf("unknown websocket broker: %q", kind)
+	}
+}
@@ -0,0 +1,67 @@
+package ws
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBroker delivers events inside the process, it is used when the API runs
+// as a single replica.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers []func(BrokerMessage)
+	statuses map[uint]string
+	lastSeen map[uint]time.Time
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		statuses: make(map[uint]string),
+		lastSeen: make(map[uint]time.Time),
+	}
+}
+
+func (b *MemoryBroker) Publish(msg BrokerMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handler func(BrokerMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func (b *MemoryBroker) SetPresence(userID uint, status string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if status == PresenceOffline {
+		delete(b.statuses, userID)
+	} else {
+		b.statuses[userID] = status
+	}
+	b.lastSeen[userID] = time.Now()
+	return nil
+}
+
+func (b *MemoryBroker) GetPresence(userID uint) (Presence, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	presence := Presence{Status: PresenceOffline}
+	if status, ok := b.statuses[userID]; ok {
+		presence.Status = status
+	}
+	if lastSeen, ok := b.lastSeen[userID]; ok {
+		presence.LastSeenAt = &lastSeen
+	}
+	return presence, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
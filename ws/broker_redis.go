@@ -0,0 +1,139 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	eventsChannel     = "ws:events"
+	presenceKeyPrefix = "ws:presence:"
+	statusKeyPrefix   = "ws:presence_status:"
+	lastSeenKeyPrefix = "ws:last_seen:"
+	// presence of a crashed replica disappears after presenceTTL
+	presenceTTL = 3 * PresenceRefreshPeriod
+)
+
+// RedisBroker shares events between replicas through redis pub/sub. Presence of
+// a user is a sorted set of replicas holding its connections, the score is the
+// time until which the replica's record is valid. Status reported by every
+// replica is kept in a hash next to it.
+type RedisBroker struct {
+	rdb    *redis.Client
+	nodeID string
+	pubsub *redis.PubSub
+}
+
+func NewRedisBroker(rdb *redis.Client) *RedisBroker {
+	return &RedisBroker{rdb: rdb, nodeID: uuid.NewString()}
+}
+
+func presenceKey(userID uint) string {
+	return presenceKeyPrefix + strconv.FormatUint(uint64(userID), 10)
+}
+
+func statusKey(userID uint) string {
+	return statusKeyPrefix + strconv.FormatUint(uint64(userID), 10)
+}
+
+func lastSeenKey(userID uint) string {
+	return lastSeenKeyPrefix + strconv.FormatUint(uint64(userID), 10)
+}
+
+func (b *RedisBroker) Publish(msg BrokerMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(context.Background(), eventsChannel, data).Err()
+}
+
+func (b *RedisBroker) Subscribe(handler func(BrokerMessage)) error {
+	ctx := context.Background()
+	b.pubsub = b.rdb.Subscribe(ctx, eventsChannel)
+	// wait for the confirmation, otherwise the first events could be lost
+	if _, err := b.pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	go func() {
+		for raw := range b.pubsub.Channel() {
+			var msg BrokerMessage
+			if err := json.Unmarshal([]byte(raw.Payload), &msg); err != nil {
+				logger.Log.WithFields(logrus.Fields{
+					"component": "websocket_chat",
+					"service":   "redis",
+				}).Errorf("could not decode broker message with error: %v", err.Error())
+				continue
+			}
+			handler(msg)
+		}
+	}()
+	return nil
+}
+
+func (b *RedisBroker) SetPresence(userID uint, status string) error {
+	ctx := context.Background()
+	now := time.Now()
+	pipe := b.rdb.TxPipeline()
+	if status == PresenceOffline {
+		pipe.ZRem(ctx, presenceKey(userID), b.nodeID)
+		pipe.HDel(ctx, statusKey(userID), b.nodeID)
+	} else {
+		expiresAt := now.Add(presenceTTL)
+		pipe.ZAdd(ctx, presenceKey(userID), redis.Z{Score: float64(expiresAt.Unix()), Member: b.nodeID})
+		pipe.ZRemRangeByScore(ctx, presenceKey(userID), "-inf", strconv.FormatInt(now.Unix(), 10))
+		pipe.Expire(ctx, presenceKey(userID), presenceTTL)
+		pipe.HSet(ctx, statusKey(userID), b.nodeID, status)
+		pipe.Expire(ctx, statusKey(userID), presenceTTL)
+	}
+	pipe.Set(ctx, lastSeenKey(userID), now.Unix(), lastSeenTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisBroker) GetPresence(userID uint) (Presence, error) {
+	ctx := context.Background()
+	presence := Presence{Status: PresenceOffline}
+	lastSeen, err := b.rdb.Get(ctx, lastSeenKey(userID)).Int64()
+	if err != nil && err != redis.Nil {
+		return presence, err
+	}
+	if err == nil {
+		lastSeenAt := time.Unix(lastSeen, 0)
+		presence.LastSeenAt = &lastSeenAt
+	}
+
+	nodes, err := b.rdb.ZRangeByScore(ctx, presenceKey(userID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(nodes) == 0 {
+		return presence, err
+	}
+	statuses, err := b.rdb.HMGet(ctx, statusKey(userID), nodes...).Result()
+	if err != nil {
+		return presence, err
+	}
+	presence.Status = PresenceAway
+	for _, status := range statuses {
+		if status == PresenceOnline {
+			presence.Status = PresenceOnline
+			break
+		}
+	}
+	return presence, nil
+}
+
+func (b *RedisBroker) Close() error {
+	if b.pubsub == nil {
+		return nil
+	}
+	return b.pubsub.Close()
+}
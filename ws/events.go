@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Types of events carried over the user-level /ws connection.
+const (
+	EventMessageNew  = "message.new"
+	EventMessageAck  = "message.ack"
+	EventMessageRead = "message.read"
+	EventMessageEdit = "message.edited"
+	EventMessageDel  = "message.deleted"
+	EventMatchNew    = "match.new"
+	EventSuperlike   = "superlike.new"
+	EventChatClosed  = "chat.closed"
+	EventTypingStart = "typing.start"
+	EventTypingStop  = "typing.stop"
+	EventPresence    = "presence"
+	EventResume      = "resume"
+	EventResumeDone  = "resume.done"
+	EventError       = "error"
+)
+
+// Event is the envelope of every frame in both directions, Data depends on Type.
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+func NewEvent(eventType string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: eventType, Data: raw}, nil
+}
+
+// SendMessagePayload is sent by the client with message.new, sender and
+// receiver are resolved by the server from the connection and the chat.
+type SendMessagePayload struct {
+	ChatID      uint   `json:"chat_id"`
+	Content     string `json:"content"`
+	ClientMsgID string `json:"client_msg_id"`
+}
+
+// AckPayload confirms that the message is stored, it is sent for retries too.
+type AckPayload struct {
+	ClientMsgID string    `json:"client_msg_id"`
+	MessageID   uint      `json:"message_id"`
+	ChatID      uint      `json:"chat_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ResumePayload is sent by the client after reconnect with the id of the last
+// message it has seen, the server replies with message.new for every newer
+// message and finishes with resume.done.
+type ResumePayload struct {
+	LastMessageID uint `json:"last_message_id"`
+}
+
+type ResumeDonePayload struct {
+	LastMessageID uint `json:"last_message_id"`
+	// HasMore means the client should send resume again with LastMessageID
+	HasMore bool `json:"has_more"`
+}
+
+// ReadPayload is sent by the receiver to report reading the chat up to
+// MessageID, the server fills ReaderID and ReadAt and pushes it to both members.
+type ReadPayload struct {
+	ChatID    uint      `json:"chat_id"`
+	MessageID uint      `json:"message_id"`
+	ReaderID  uint      `json:"reader_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+// DeletedPayload is pushed to both members for "delete for everyone" and only
+// to the user's own connections for "delete for me".
+type DeletedPayload struct {
+	ChatID      uint `json:"chat_id"`
+	MessageID   uint `json:"message_id"`
+	ForEveryone bool `json:"for_everyone"`
+}
+
+type TypingPayload struct {
+	ChatID uint `json:"chat_id"`
+	UserID uint `json:"user_id"`
+}
+
+// PresencePayload is pushed to chat partners when the status changes, the
+// client sends it with status online or away when the app goes to background.
+type PresencePayload struct {
+	UserID     uint       `json:"user_id"`
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+type MatchUser struct {
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+}
+
+type MatchPayload struct {
+	ChatID uint      `json:"chat_id"`
+	User   MatchUser `json:"user"`
+}
+
+// SuperlikePayload tells the user who superliked them, a match sends MatchPayload instead.
+type SuperlikePayload struct {
+	User MatchUser `json:"user"`
+}
+
+// ChatClosedPayload tells the client to remove the chat after unmatch or block.
+type ChatClosedPayload struct {
+	ChatID uint `json:"chat_id"`
+}
+
+type ErrorPayload struct {
+	Error string `json:"error"`
+}
+
+func newMatchUser(user *models.User) MatchUser {
+	return MatchUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+	}
+}
+
+func NewMatchPayload(chatID uint, user *models.User) MatchPayload {
+	return MatchPayload{ChatID: chatID, User: newMatchUser(user)}
+}
+
+func NewSuperlikePayload(user *models.User) SuperlikePayload {
+	return SuperlikePayload{User: newMatchUser(user)}
+}
+
+// Publish sends the event to every connection of the users, it is used by
+// HTTP controllers to push server-side events.
+func Publish(eventType string, data interface{}, userIDs ...uint) {
+	event, err := NewEvent(eventType, data)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component":  "websocket_chat",
+			"event_type": eventType,
+		}).Errorf("could not encode event with error: %v", err.Error())
+		return
+	}
+	HubInstance.SendToUsers(event, userIDs...)
+}
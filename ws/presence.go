@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PresenceOnline  = models.PresenceOnline
+	PresenceAway    = models.PresenceAway
+	PresenceOffline = models.PresenceOffline
+)
+
+// lastSeenTTL is how long last_seen_at is kept after the user went offline.
+const lastSeenTTL = 30 * 24 * time.Hour
+
+type Presence = models.Presence
+
+// GetPresence returns presence of the user across all replicas.
+func (h *Hub) GetPresence(userID uint) Presence {
+	presence, err := h.Broker.GetPresence(userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+		}).Errorf("could not get presence with error: %v", err.Error())
+		h.Mu.Lock()
+		defer h.Mu.Unlock()
+		return Presence{Status: h.localStatus(userID)}
+	}
+	return presence
+}
+
+// PresenceOf returns nil for users who hide their presence.
+func PresenceOf(userID uint, hidden bool) *Presence {
+	if hidden {
+		return nil
+	}
+	presence := HubInstance.GetPresence(userID)
+	return &presence
+}
+
+// SetClientStatus is called when the client reports that the app went to the
+// background (away) or came back (online).
+func (h *Hub) SetClientStatus(client *Client, status string) {
+	h.Mu.Lock()
+	if !h.Users[client.UserID][client] || client.status == status {
+		h.Mu.Unlock()
+		return
+	}
+	before := h.localStatus(client.UserID)
+	client.status = status
+	if after := h.localStatus(client.UserID); after != before {
+		h.queuePresence(client.UserID, after)
+	}
+	h.Mu.Unlock()
+	h.flushPresence()
+}
+
+// localStatus aggregates connections of the user on this replica, it must be
+// called with Mu held.
+func (h *Hub) localStatus(userID uint) string {
+	clients := h.Users[userID]
+	if len(clients) == 0 {
+		return PresenceOffline
+	}
+	for client := range clients {
+		if client.status == PresenceOnline {
+			return PresenceOnline
+		}
+	}
+	return PresenceAway
+}
+
+// queuePresence records the new status of the user, it must be called with Mu held.
+// The broker may be a network round trip away, so it is written by flushPresence
+// after Mu is released.
+func (h *Hub) queuePresence(userID uint, status string) {
+	if h.pendingPresence == nil {
+		h.pendingPresence = make(map[uint]string)
+	}
+	h.pendingPresence[userID] = status
+}
+
+// flushPresence writes the queued statuses, it must be called without Mu held.
+func (h *Hub) flushPresence() {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	h.Mu.Lock()
+	pending := h.pendingPresence
+	h.pendingPresence = nil
+	h.Mu.Unlock()
+	for userID, status := range pending {
+		h.setPresence(userID, status)
+	}
+}
+
+func (h *Hub) setPresence(userID uint, status string) {
+	if err := h.Broker.SetPresence(userID, status); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+			"user_id":   userID,
+		}).Errorf("could not update presence with error: %v", err.Error())
+		return
+	}
+	go announcePresence(userID)
+}
+
+// announcePresence pushes the current presence of the user to its chat partners,
+// nothing is sent when the user hides presence.
+func announcePresence(userID uint) {
+	userService := service.NewUserService(repository.NewPostgresUserRepo(config.DB))
+	user, err := userService.GetUserByID(userID)
+	if err != nil || user.HidePresence {
+		return
+	}
+	chatService := service.NewChatService(repository.NewPostgresChatRepo(config.DB))
+	partners, err := chatService.GetChatPartnerIDs(userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+			"user_id":   userID,
+		}).Errorf("could not get chat partners with error: %v", err.Error())
+		return
+	}
+	if len(partners) == 0 {
+		return
+	}
+	presence := HubInstance.GetPresence(userID)
+	Publish(EventPresence, PresencePayload{
+		UserID:     userID,
+		Status:     presence.Status,
+		LastSeenAt: presence.LastSeenAt,
+	}, partners...)
+}
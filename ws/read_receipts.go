@@ -0,0 +1,37 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/sirupsen/logrus"
+)
+
+// MarkRead marks messages received by the reader in the chat up to messageID as
+// read and pushes message.read to both members, the sender sees the receipt and
+// other devices of the reader update unread counters. It is shared by the REST
+// endpoint and the websocket event.
+func MarkRead(chatService service.ChatService, chat *models.Chat, readerID uint, messageID uint) error {
+	readAt := time.Now()
+	count, err := chatService.MarkMessagesRead(chat.ID, readerID, messageID, readAt)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "chat",
+			"chat_id":   chat.ID,
+			"reader_id": readerID,
+		}).Errorf("could not mark messages as read with error: %v", err.Error())
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	Publish(EventMessageRead, ReadPayload{
+		ChatID:    chat.ID,
+		MessageID: messageID,
+		ReaderID:  readerID,
+		ReadAt:    readAt,
+	}, chat.User1ID, chat.User2ID)
+	return nil
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ilyaDyb/go_rest_api/config/redis"
+	"github.com/ilyaDyb/go_rest_api/middleware"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/ilyaDyb/go_rest_api/utils"
+)
+
+// Browsers can't set the Authorization header on a websocket upgrade, so the
+// access token is passed either as ?token= or as the subprotocol pair "bearer, <token>".
+const tokenSubprotocol = "bearer"
+
+// Private close codes (4000-4999), they mirror HTTP statuses.
+const (
+	CloseBadRequest   = 4400
+	CloseUnauthorized = 4401
+	CloseForbidden    = 4403
+	// CloseReplaced means the session opened a newer connection
+	CloseReplaced = 4409
+	// CloseTooSlow means the client didn't read events fast enough, it should resume
+	CloseTooSlow = 4429
+)
+
+func tokenFromRequest(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == tokenSubprotocol {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+func authenticate(r *http.Request) (*utils.Claims, error) {
+	token := tokenFromRequest(r)
+	if token == "" {
+		return nil, middleware.ErrInvalidToken
+	}
+	sessionService := service.NewSessionService(repository.NewRedisSessionRepo(redis.RedisClient))
+	return middleware.ValidateAccessToken(sessionService, token)
+}
+
+// closeWithCode rejects already upgraded connection, clients can't read the
+// HTTP status of a failed upgrade but they get the close code.
+func closeWithCode(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
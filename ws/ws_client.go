@@ -0,0 +1,300 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/models"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 8 << 10
+	sendBufferSize = 512
+	// resumeBatchSize is kept well below sendBufferSize, so a resume doesn't overflow the buffer
+	resumeBatchSize = 100
+	// resumeOverlap is how far resume looks back before the last seen message for
+	// messages which were committed after it
+	resumeOverlap     = 5 * time.Second
+	maxClientMsgIDLen = 64
+	// typing.start is forwarded at most once per typingThrottle for a chat
+	typingThrottle = 3 * time.Second
+)
+
+// Client is one authenticated connection, it receives events of all chats of the user.
+type Client struct {
+	UserID    uint
+	Username  string
+	SessionID string
+	Conn      *websocket.Conn
+	Send      chan Event
+
+	chatService service.ChatService
+	// status is online or away, it is guarded by the hub's Mu
+	status string
+	// typingSentAt throttles typing.start per chat, it is used only by ReadPump
+	typingSentAt map[uint]time.Time
+	// resumedUpTo is the last message of a resume page with more messages left,
+	// resuming from it continues the same pass without the overlap
+	resumedUpTo uint
+	// closeCode is sent to the client when the hub closes Send
+	closeCode   int
+	closeReason string
+}
+
+func NewClient(user *models.User, sessionID string, conn *websocket.Conn, chatService service.ChatService) *Client {
+	return &Client{
+		UserID:       user.ID,
+		Username:     user.Username,
+		SessionID:    sessionID,
+		Conn:         conn,
+		Send:         make(chan Event, sendBufferSize),
+		chatService:  chatService,
+		status:       PresenceOnline,
+		typingSentAt: make(map[uint]time.Time),
+	}
+}
+
+func (c *Client) ReadPump() {
+	defer func() {
+		HubInstance.Unregister <- c
+		c.Conn.Close()
+	}()
+	c.Conn.SetReadLimit(maxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var event Event
+		if err := c.Conn.ReadJSON(&event); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.Log.WithFields(logrus.Fields{
+					"component": "websocket_chat",
+					"username":  c.Username,
+				}).Errorf("error reading message: %v", err.Error())
+			}
+			break
+		}
+		c.handleEvent(event)
+	}
+}
+
+func (c *Client) WritePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+	for {
+		select {
+		case event, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				if c.closeCode != 0 {
+					c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeReason))
+				} else {
+					c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				}
+				return
+			}
+			if err := c.Conn.WriteJSON(event); err != nil {
+				logger.Log.WithFields(logrus.Fields{
+					"component": "websocket_chat",
+					"username":  c.Username,
+				}).Errorf("error writing message: %v", err.Error())
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) handleEvent(event Event) {
+	switch event.Type {
+	case EventMessageNew:
+		var payload SendMessagePayload
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			c.sendError("invalid message.new payload")
+			return
+		}
+		c.sendMessage(payload)
+	case EventMessageRead:
+		var payload ReadPayload
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			c.sendError("invalid message.read payload")
+			return
+		}
+		chat, ok := c.memberChat(payload.ChatID)
+		if !ok {
+			return
+		}
+		if err := MarkRead(c.chatService, chat, c.UserID, payload.MessageID); err != nil {
+			c.sendError("could not mark messages as read")
+		}
+	case EventResume:
+		var payload ResumePayload
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			c.sendError("invalid resume payload")
+			return
+		}
+		c.resume(payload.LastMessageID)
+	case EventTypingStart, EventTypingStop:
+		var payload TypingPayload
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			c.sendError("invalid typing payload")
+			return
+		}
+		c.typing(event.Type, payload.ChatID)
+	case EventPresence:
+		var payload PresencePayload
+		if err := json.Unmarshal(event.Data, &payload); err != nil ||
+			(payload.Status != PresenceOnline && payload.Status != PresenceAway) {
+			c.sendError("presence status must be online or away")
+			return
+		}
+		HubInstance.SetClientStatus(c, payload.Status)
+	default:
+		c.sendError("unknown event type: " + event.Type)
+	}
+}
+
+func (c *Client) sendMessage(payload SendMessagePayload) {
+	if strings.TrimSpace(payload.Content) == "" {
+		c.sendError("message content is empty")
+		return
+	}
+	if len(payload.ClientMsgID) > maxClientMsgIDLen {
+		c.sendError("client_msg_id is too long")
+		return
+	}
+	chat, ok := c.memberChat(payload.ChatID)
+	if !ok {
+		return
+	}
+	message := models.Message{
+		ChatID:     chat.ID,
+		SenderID:   c.UserID,
+		ReceiverID: chat.OtherMember(c.UserID),
+		Content:    payload.Content,
+	}
+	if payload.ClientMsgID != "" {
+		message.ClientMsgID = &payload.ClientMsgID
+	}
+	created, err := c.chatService.CreateMessageOnce(&message)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+			"chat_id":   chat.ID,
+			"sender_id": c.UserID,
+		}).Errorf("could not save message with error: %v", err.Error())
+		c.sendError("could not save message")
+		return
+	}
+	c.send(EventMessageAck, AckPayload{
+		ClientMsgID: payload.ClientMsgID,
+		MessageID:   message.ID,
+		ChatID:      message.ChatID,
+		CreatedAt:   message.CreatedAt,
+	})
+	// a retry of already stored message is only acked, the receiver got it
+	// the first time or will get it on resume
+	delete(c.typingSentAt, chat.ID)
+	if created {
+		log.Printf("message %d was sent to chat %d", message.ID, chat.ID)
+		Publish(EventMessageNew, message, message.SenderID, message.ReceiverID)
+	}
+}
+
+// typing forwards typing indicators to the other member, they are never stored.
+// Repeated typing.start is throttled, typing.stop is forwarded only after a start.
+func (c *Client) typing(eventType string, chatID uint) {
+	sentAt, started := c.typingSentAt[chatID]
+	if eventType == EventTypingStart && started && time.Since(sentAt) < typingThrottle {
+		return
+	}
+	if eventType == EventTypingStop && !started {
+		return
+	}
+	chat, ok := c.memberChat(chatID)
+	if !ok {
+		return
+	}
+	if eventType == EventTypingStart {
+		c.typingSentAt[chatID] = time.Now()
+	} else {
+		delete(c.typingSentAt, chatID)
+	}
+	Publish(eventType, TypingPayload{ChatID: chat.ID, UserID: c.UserID}, chat.OtherMember(c.UserID))
+}
+
+// resume sends the messages the client missed while it was disconnected.
+func (c *Client) resume(lastMessageID uint) {
+	overlap := resumeOverlap
+	if lastMessageID != 0 && lastMessageID == c.resumedUpTo {
+		overlap = 0
+	}
+	messages, err := c.chatService.GetUserMessagesAfter(c.UserID, lastMessageID, overlap, resumeBatchSize)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+			"username":  c.Username,
+		}).Errorf("could not load missed messages with error: %v", err.Error())
+		c.sendError("could not load missed messages")
+		return
+	}
+	for _, message := range *messages {
+		c.send(EventMessageNew, message)
+		lastMessageID = message.ID
+	}
+	hasMore := len(*messages) == resumeBatchSize
+	c.resumedUpTo = 0
+	if hasMore {
+		c.resumedUpTo = lastMessageID
+	}
+	c.send(EventResumeDone, ResumeDonePayload{
+		LastMessageID: lastMessageID,
+		HasMore:       hasMore,
+	})
+}
+
+// memberChat loads the chat and checks that the client belongs to it,
+// membership is checked on every event because chats can be closed.
+func (c *Client) memberChat(chatID uint) (*models.Chat, bool) {
+	chat, err := c.chatService.GetChatByID(chatID)
+	if err != nil || !chat.HasMember(c.UserID) {
+		c.sendError("you are not a member of this chat")
+		return nil, false
+	}
+	return chat, true
+}
+
+func (c *Client) sendError(msg string) {
+	c.send(EventError, ErrorPayload{Error: msg})
+}
+
+// send delivers the event only to this connection.
+func (c *Client) send(eventType string, data interface{}) {
+	event, err := NewEvent(eventType, data)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component":  "websocket_chat",
+			"event_type": eventType,
+		}).Errorf("could not encode event with error: %v", err.Error())
+		return
+	}
+	HubInstance.SendToClient(c, event)
+}
@@ -1,52 +1,57 @@
 package ws
 
 import (
-	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/ilyaDyb/go_rest_api/repository"
+	"github.com/ilyaDyb/go_rest_api/service"
+	"github.com/sirupsen/logrus"
 )
 
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize: 1024,
 	WriteBufferSize: 1024,
+	Subprotocols: []string{tokenSubprotocol},
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
 
+// WsHandler opens the user-level connection which carries events of all chats of the user.
 func WsHandler(c *gin.Context) {
-	chatID := c.Param("chatID")
-	username := c.Param("username")
+	claims, authErr := authenticate(c.Request)
 
-	chatIDInt, err := strconv.Atoi(chatID)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		http.Error(c.Writer, "Invalid chat ID", http.StatusBadRequest)
+		// upgrader has already responded with the error
 		return
 	}
-	chatIDUint := uint(chatIDInt)
-
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		http.Error(c.Writer, "Failed to upgrade to websocket", http.StatusBadRequest)
+	if authErr != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+			"ip":        c.ClientIP(),
+		}).Infof("websocket upgrade rejected: %v", authErr.Error())
+		closeWithCode(conn, CloseUnauthorized, authErr.Error())
 		return
 	}
 
-	client := NewClient(chatIDUint, username, conn)
-	log.Printf("Client was created with username: %v and chatID: %v", username, chatIDUint)
-
-	if len(HubInstance.Chats[chatIDUint]) >= 2 {
-		client.Conn.WriteMessage(websocket.TextMessage, []byte("Chat is full"))
-		client.Conn.Close()
+	userService := service.NewUserService(repository.NewPostgresUserRepo(config.DB))
+	chatService := service.NewChatService(repository.NewPostgresChatRepo(config.DB))
+	user, err := userService.GetUserByUsername(claims.Username)
+	if err != nil {
+		closeWithCode(conn, CloseUnauthorized, "user not found")
 		return
 	}
 
+	client := NewClient(user, claims.SessionID, conn, chatService)
 	HubInstance.Register <- client
 
 	go client.ReadPump()
 	go client.WritePump()
-}
\ No newline at end of file
+}
@@ -0,0 +1,187 @@
+package ws
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// Delivery addresses the event either to all local connections of the users
+// or, when Client is set, to that single connection.
+type Delivery struct {
+	UserIDs []uint
+	Client  *Client
+	Event   Event
+}
+
+// Hub keeps local connections by user, a user has one connection per session.
+// Events for users go through the Broker, so they reach connections held by
+// other replicas too.
+type Hub struct {
+	Users      map[uint]map[*Client]bool
+	Register   chan *Client
+	Unregister chan *Client
+	Deliver    chan Delivery
+	Broker     Broker
+	Mu         sync.Mutex
+
+	// pendingPresence holds status changes made under Mu until flushPresence
+	// writes them to the broker, presenceMu keeps the writes in order.
+	pendingPresence map[uint]string
+	presenceMu      sync.Mutex
+}
+
+var HubInstance = &Hub{
+	Users:      make(map[uint]map[*Client]bool),
+	Register:   make(chan *Client),
+	Unregister: make(chan *Client),
+	Deliver:    make(chan Delivery, 1024),
+	Broker:     NewMemoryBroker(),
+}
+
+// Start subscribes the hub to the broker and runs it.
+func (h *Hub) Start() error {
+	err := h.Broker.Subscribe(func(msg BrokerMessage) {
+		h.Deliver <- Delivery{UserIDs: msg.UserIDs, Event: msg.Event}
+	})
+	if err != nil {
+		return err
+	}
+	go h.Run()
+	return nil
+}
+
+func (h *Hub) SendToUsers(event Event, userIDs ...uint) {
+	if err := h.Broker.Publish(BrokerMessage{UserIDs: userIDs, Event: event}); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"component":  "websocket_chat",
+			"event_type": event.Type,
+		}).Errorf("could not publish event with error: %v", err.Error())
+	}
+}
+
+// SendToClient delivers the event to the single local connection, it never
+// leaves the replica.
+func (h *Hub) SendToClient(client *Client, event Event) {
+	h.Deliver <- Delivery{Client: client, Event: event}
+}
+
+func (h *Hub) Run() {
+	ticker := time.NewTicker(PresenceRefreshPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case client := <-h.Register:
+			h.Mu.Lock()
+			before := h.localStatus(client.UserID)
+			if h.Users[client.UserID] == nil {
+				h.Users[client.UserID] = make(map[*Client]bool)
+			}
+			h.Users[client.UserID][client] = true
+			// the newer connection of the same session replaces the old one
+			for other := range h.Users[client.UserID] {
+				if other != client && other.SessionID == client.SessionID {
+					other.closeCode, other.closeReason = CloseReplaced, "replaced by a newer connection"
+					h.remove(other)
+				}
+			}
+			if after := h.localStatus(client.UserID); after != before {
+				h.queuePresence(client.UserID, after)
+			}
+			h.Mu.Unlock()
+			h.flushPresence()
+			log.Printf("Client connected: %s", client.Username)
+			logger.Log.WithFields(logrus.Fields{
+				"component": "websocket_chat",
+			}).Infof("Client connected: %s", client.Username)
+
+		case client := <-h.Unregister:
+			h.Mu.Lock()
+			if h.remove(client) {
+				log.Printf("Client disconnected: %s", client.Username)
+				logger.Log.WithFields(logrus.Fields{
+					"component": "websocket_chat",
+				}).Infof("Client disconnected: %s", client.Username)
+			}
+			h.Mu.Unlock()
+			h.flushPresence()
+
+		case delivery := <-h.Deliver:
+			h.Mu.Lock()
+			if delivery.Client != nil {
+				if h.Users[delivery.Client.UserID][delivery.Client] {
+					h.send(delivery.Client, delivery.Event)
+				}
+			}
+			for _, userID := range delivery.UserIDs {
+				for client := range h.Users[userID] {
+					h.send(client, delivery.Event)
+				}
+			}
+			h.Mu.Unlock()
+			// slow clients may have been disconnected
+			h.flushPresence()
+
+		case <-ticker.C:
+			h.refreshPresence()
+		}
+	}
+}
+
+// send disconnects the client which can't keep up instead of silently losing
+// the event, the client reconnects and resumes from its last message.
+// It must be called with Mu held.
+func (h *Hub) send(client *Client, event Event) {
+	select {
+	case client.Send <- event:
+	default:
+		client.closeCode, client.closeReason = CloseTooSlow, "too many pending events, reconnect and resume"
+		h.remove(client)
+		logger.Log.WithFields(logrus.Fields{
+			"component": "websocket_chat",
+			"username":  client.Username,
+		}).Warn("client can't keep up with events and was disconnected")
+	}
+}
+
+// refreshPresence is the heartbeat which keeps presence of this replica's users
+// from expiring. The statuses are copied under Mu and written without it.
+func (h *Hub) refreshPresence() {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	h.Mu.Lock()
+	statuses := make(map[uint]string, len(h.Users))
+	for userID := range h.Users {
+		statuses[userID] = h.localStatus(userID)
+	}
+	h.Mu.Unlock()
+	for userID, status := range statuses {
+		if err := h.Broker.SetPresence(userID, status); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"component": "websocket_chat",
+				"user_id":   userID,
+			}).Errorf("could not refresh presence with error: %v", err.Error())
+		}
+	}
+}
+
+// remove must be called with Mu held, it reports whether the client was registered.
+func (h *Hub) remove(client *Client) bool {
+	clients, ok := h.Users[client.UserID]
+	if !ok || !clients[client] {
+		return false
+	}
+	before := h.localStatus(client.UserID)
+	delete(clients, client)
+	close(client.Send)
+	if len(clients) == 0 {
+		delete(h.Users, client.UserID)
+	}
+	if after := h.localStatus(client.UserID); after != before {
+		h.queuePresence(client.UserID, after)
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ilyaDyb/go_rest_api/config"
+	"github.com/ilyaDyb/go_rest_api/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	config.ConnectTestDB()
+	os.Exit(m.Run())
+}
+
+// slowBroker holds SetPresence until the test releases it.
+type slowBroker struct {
+	*MemoryBroker
+	entered chan uint
+	release chan struct{}
+}
+
+func (b *slowBroker) SetPresence(userID uint, status string) error {
+	b.entered <- userID
+	<-b.release
+	return b.MemoryBroker.SetPresence(userID, status)
+}
+
+func TestPresenceIsWrittenWithoutHubLock(t *testing.T) {
+	broker := &slowBroker{MemoryBroker: NewMemoryBroker(), entered: make(chan uint), release: make(chan struct{})}
+	hub := &Hub{
+		Users:      make(map[uint]map[*Client]bool),
+		Register:   make(chan *Client),
+		Unregister: make(chan *Client),
+		Deliver:    make(chan Delivery, 1),
+		Broker:     broker,
+	}
+	go hub.Run()
+
+	client := &Client{UserID: 7, SessionID: "s", Send: make(chan Event, 1), status: PresenceOnline}
+	hub.Register <- client
+	select {
+	case userID := <-broker.entered:
+		assert.Equal(t, client.UserID, userID)
+	case <-time.After(time.Second):
+		t.Fatal("presence was not written")
+	}
+
+	// the broker is still busy, the hub's connections must stay available
+	require.True(t, hub.Mu.TryLock())
+	assert.True(t, hub.Users[client.UserID][client])
+	hub.Mu.Unlock()
+
+	close(broker.release)
+	assert.Eventually(t, func() bool {
+		presence, err := broker.MemoryBroker.GetPresence(client.UserID)
+		return err == nil && presence.Status == PresenceOnline
+	}, time.Second, 10*time.Millisecond)
+}
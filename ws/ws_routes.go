@@ -3,5 +3,5 @@ package ws
 import "github.com/gin-gonic/gin"
 
 func RegisterWsRoutes(router *gin.Engine) {
-	router.GET("/ws/:chatID/:username", WsHandler)
-}
\ No newline at end of file
+	router.GET("/ws", WsHandler)
+}